@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Attributes issued to enrolled identities by the Fabric CA that the chaincode relies on.
+const (
+	roleAttribute          = "role"
+	userIDAttribute        = "userId"
+	providerAdminAttribute = "provider-admin"
+	adminRole              = "admin"
+)
+
+// isAdmin returns true when the submitting identity carries the admin role attribute.
+func isAdmin(ctx contractapi.TransactionContextInterface) (bool, error) {
+	role, found, err := ctx.GetClientIdentity().GetAttributeValue(roleAttribute)
+	if err != nil {
+		return false, fmt.Errorf("failed to read client identity attributes: %v", err)
+	}
+
+	return found && role == adminRole, nil
+}
+
+// assertAdmin returns an error unless the submitting identity is an admin.
+func assertAdmin(ctx contractapi.TransactionContextInterface) error {
+	admin, err := isAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return fmt.Errorf("permission denied: caller is not an admin")
+	}
+
+	return nil
+}
+
+// assertProviderAdmin returns an error unless the submitting identity may manage consents of the
+// given provider: either a global admin, or a provider admin whose provider-admin attribute names
+// that provider (e.g. provider-admin=JIO).
+func assertProviderAdmin(ctx contractapi.TransactionContextInterface, provider string) error {
+	admin, err := isAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if admin {
+		return nil
+	}
+
+	err = ctx.GetClientIdentity().AssertAttributeValue(providerAdminAttribute, provider)
+	if err != nil {
+		return fmt.Errorf("permission denied: caller is not an admin for provider %s", provider)
+	}
+
+	return nil
+}
+
+// assertUserOrProviderAdmin returns an error unless the submitting identity is the user the consent
+// belongs to or an admin for its provider.
+func assertUserOrProviderAdmin(ctx contractapi.TransactionContextInterface, consent *Consent) error {
+	caller, err := callerUserID(ctx)
+	if err == nil && caller == consent.UserID {
+		return nil
+	}
+
+	return assertProviderAdmin(ctx, consent.Provider)
+}
+
+// callerUserID returns the user ID attribute of the submitting identity.
+func callerUserID(ctx contractapi.TransactionContextInterface) (string, error) {
+	userId, found, err := ctx.GetClientIdentity().GetAttributeValue(userIDAttribute)
+	if err != nil {
+		return "", fmt.Errorf("failed to read client identity attributes: %v", err)
+	}
+	if !found || userId == "" {
+		return "", fmt.Errorf("the client identity has no %s attribute", userIDAttribute)
+	}
+
+	return userId, nil
+}
+
+// callerID returns the unique ID of the submitting identity, derived from its certificate's
+// subject and issuer.
+func callerID(ctx contractapi.TransactionContextInterface) (string, error) {
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client identity: %v", err)
+	}
+
+	return id, nil
+}
+
+// callerMSPID returns the MSP ID of the organization of the submitting identity.
+func callerMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspId, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client identity MSP ID: %v", err)
+	}
+
+	return mspId, nil
+}
+
+// assertOwnerMSP returns an error unless the submitting identity belongs to the organization that
+// created the consent. Consents without a recorded creator MSP, such as those seeded by InitLedger,
+// are exempt.
+func assertOwnerMSP(ctx contractapi.TransactionContextInterface, consent *Consent) error {
+	if consent.CreatorMSP == "" {
+		return nil
+	}
+	mspId, err := callerMSPID(ctx)
+	if err != nil {
+		return err
+	}
+	if mspId != consent.CreatorMSP {
+		return fmt.Errorf("permission denied: consent %s is owned by %s", consent.ID, consent.CreatorMSP)
+	}
+
+	return nil
+}
+
+// assertUserOrAdmin returns an error unless the submitting identity is the given user or an admin.
+func assertUserOrAdmin(ctx contractapi.TransactionContextInterface, userId string) error {
+	admin, err := isAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if admin {
+		return nil
+	}
+
+	caller, err := callerUserID(ctx)
+	if err != nil || caller != userId {
+		return fmt.Errorf("permission denied: caller is neither user %s nor an admin", userId)
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// archivedConsentObjectType is the composite key namespace holding archived consents. Archived
+// records are outside the live key range, so range scans skip them, and decodeQueryResult drops
+// them from rich query results, which would otherwise match them too.
+const archivedConsentObjectType = "archivedConsent"
+
+// ArchiveConsent removes a consent from the live world state and keeps a copy stamped with
+// DeletedAt in the archive until PurgeArchivedConsents removes it after the retention period.
+// The caller must belong to the organization that created the consent and be an admin for its
+// provider.
+func (s *SmartContract) ArchiveConsent(ctx contractapi.TransactionContextInterface, id string) error {
+	consent, err := s.readConsentForChange(ctx, id)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = deleteConsent(ctx, consent)
+	if err != nil {
+		return err
+	}
+
+	consent.DeletedAt = now.UTC().Format(time.RFC3339)
+	archiveKey, err := ctx.GetStub().CreateCompositeKey(archivedConsentObjectType, []string{id})
+	if err != nil {
+		return err
+	}
+	consentJSON, err := marshalConsent(consent)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(archiveKey, consentJSON)
+}
+
+// PurgeArchivedConsents permanently deletes archived consents whose DeletedAt is older than the
+// retention period and returns the number purged. Only admins may purge.
+func (s *SmartContract) PurgeArchivedConsents(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	retentionDays, err := s.GetRetentionDays(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := now.AddDate(0, 0, -retentionDays)
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(archivedConsentObjectType, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	purged := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var consent Consent
+		err = json.Unmarshal(queryResponse.Value, &consent)
+		if err != nil {
+			return 0, err
+		}
+		deletedAt, err := parseConsentDate("deletedAt", consent.DeletedAt)
+		if err != nil {
+			return 0, fmt.Errorf("archived consent %s: %v", consent.ID, err)
+		}
+		if !deletedAt.Before(cutoff) {
+			continue
+		}
+
+		err = ctx.GetStub().DelState(queryResponse.Key)
+		if err != nil {
+			return 0, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// deleteArchivedConsentsForUser permanently deletes the archived consents of the given user and
+// returns how many were deleted.
+func deleteArchivedConsentsForUser(ctx contractapi.TransactionContextInterface, userId string) (int, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(archivedConsentObjectType, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	deleted := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var consent Consent
+		err = json.Unmarshal(queryResponse.Value, &consent)
+		if err != nil {
+			return 0, err
+		}
+		if consent.UserID != userId {
+			continue
+		}
+
+		err = ctx.GetStub().DelState(queryResponse.Key)
+		if err != nil {
+			return 0, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// expiredConsentsDeleted is the payload of the ExpiredConsentsDeleted event.
+type expiredConsentsDeleted struct {
+	Count      int      `json:"count"`
+	ConsentIDs []string `json:"consentIds"`
+}
+
+// DeleteExpiredConsents deletes every consent whose expiration date is before the transaction
+// timestamp, granted or revoked, and returns the number removed. Expiry is judged against the
+// transaction timestamp, never the peer's clock, so all endorsers delete the same records. Consents
+// under legal hold, owned by another organization or with an unparseable expiration date are left
+// in place. A single ExpiredConsentsDeleted event lists the deleted IDs. Only admins may run it.
+func (s *SmartContract) DeleteExpiredConsents(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []*Consent
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+		if err != nil || !expiration.Before(now) || consent.Frozen {
+			return nil
+		}
+		if assertOwnerMSP(ctx, consent) != nil {
+			return nil
+		}
+		expired = append(expired, consent)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := expiredConsentsDeleted{ConsentIDs: []string{}}
+	for _, consent := range expired {
+		err = deleteConsent(ctx, consent)
+		if err != nil {
+			return 0, err
+		}
+		deleted.ConsentIDs = append(deleted.ConsentIDs, consent.ID)
+	}
+	deleted.Count = len(deleted.ConsentIDs)
+
+	if deleted.Count > 0 {
+		err = emitEvent(ctx, "ExpiredConsentsDeleted", deleted)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return deleted.Count, nil
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
@@ -15,14 +18,63 @@ type SmartContract struct {
 
 // Consent defines the structure for a consent asset
 type Consent struct {
-	ID             string `json:"id"`
-	UserID         string `json:"userId"`
-	Service        string `json:"service"`
-	Provider       string `json:"provider"` // JIO or Airtel
-	ConsentGiven   bool   `json:"consentGiven"`
-	Timestamp      string `json:"timestamp"`
-	ExpirationDate string `json:"expirationDate"`
-	Purpose        string `json:"purpose"`
+	ID               string   `json:"id"`
+	UserID           string   `json:"userId"`
+	Service          string   `json:"service"`
+	Provider         string   `json:"provider"` // one of allowedProviders
+	ConsentGiven     bool     `json:"consentGiven"`
+	Timestamp        string   `json:"timestamp"`
+	ExpirationDate   string   `json:"expirationDate"`
+	Purpose          string   `json:"purpose"`
+	Signature        string   `json:"signature,omitempty" metadata:",optional"`
+	RevokedAt        string   `json:"revokedAt,omitempty" metadata:",optional"`
+	RevocationReason string   `json:"revocationReason,omitempty" metadata:",optional"`
+	RevocationTxID   string   `json:"revocationTxId,omitempty" metadata:",optional"`
+	ParentID         string   `json:"parentId,omitempty" metadata:",optional"`
+	EffectiveFrom    string   `json:"effectiveFrom,omitempty" metadata:",optional"`
+	DeletedAt        string   `json:"deletedAt,omitempty" metadata:",optional"`
+	Tags             []string `json:"tags,omitempty" metadata:",optional"`
+	CollectionMethod string   `json:"collectionMethod,omitempty" metadata:",optional"`
+	ReminderSentAt   string   `json:"reminderSentAt,omitempty" metadata:",optional"`
+	TermsVersion     string   `json:"termsVersion,omitempty" metadata:",optional"`
+	// RetentionCategory drives downstream purge schedules, e.g. "short", "standard" or "long"
+	RetentionCategory string `json:"retentionCategory,omitempty" metadata:",optional"`
+	SchemaVersion     int    `json:"schemaVersion,omitempty" metadata:",optional"`
+	OptedOut          bool   `json:"optedOut,omitempty" metadata:",optional"`
+	// Status is the effective status as of the last write or MaterializeStatuses run, stored so
+	// off-chain consumers can query on it. It goes stale as time passes; consentStatus is
+	// authoritative, and only reads it back for consents SetConsentStatus made pending or expired.
+	Status string `json:"status,omitempty" metadata:",optional"`
+	// Region is the jurisdiction whose expiry policy caps the consent's validity, e.g. "EU"
+	Region string `json:"region,omitempty" metadata:",optional"`
+	// MaxUses is how many times the consent may be used before it is exhausted, 0 meaning unlimited
+	MaxUses  int `json:"maxUses,omitempty" metadata:",optional"`
+	UseCount int `json:"useCount,omitempty" metadata:",optional"`
+	// AgeVerified records that the user's minimum age was checked, required for age-restricted services
+	AgeVerified bool `json:"ageVerified,omitempty" metadata:",optional"`
+	// DedupKey is the hex SHA-256 of userId, service and provider, shared by duplicate consents
+	DedupKey string `json:"dedupKey,omitempty" metadata:",optional"`
+	// Frozen places the consent under legal hold: it cannot be modified or deleted until released
+	Frozen bool `json:"frozen,omitempty" metadata:",optional"`
+	// CreatedBy and CreatorMSP identify the submitter of the transaction that created the consent,
+	// UpdatedBy and UpdaterMSP that of the latest write. IDs are client identity IDs. The creator
+	// MSP owns the consent: only its members may update, revoke or delete it.
+	CreatedBy  string `json:"createdBy,omitempty" metadata:",optional"`
+	CreatorMSP string `json:"creatorMsp,omitempty" metadata:",optional"`
+	UpdatedBy  string `json:"updatedBy,omitempty" metadata:",optional"`
+	UpdaterMSP string `json:"updaterMsp,omitempty" metadata:",optional"`
+	// Scopes are further services covered by the same grant, on top of Service
+	Scopes []string `json:"scopes,omitempty" metadata:",optional"`
+	// PrivateDataHash is the hex SHA-256 of the consent's private details, set on consents created by
+	// CreateConsentPrivate whose UserID and Purpose are kept in privateConsentCollection instead
+	PrivateDataHash string `json:"privateDataHash,omitempty" metadata:",optional"`
+	// ExternalRefs maps an external system, e.g. a provider CRM, to the consent's ID in that system
+	ExternalRefs map[string]string `json:"externalRefs,omitempty" metadata:",optional"`
+	// Metadata holds free-form provider attributes, e.g. a campaign ID or legal basis
+	Metadata map[string]string `json:"metadata,omitempty" metadata:",optional"`
+	// PreviousValues holds the old values of the fields changed by the latest UpdateConsent only;
+	// earlier versions are returned by GetConsentHistory.
+	PreviousValues map[string]string `json:"previousValues,omitempty" metadata:",optional"`
 }
 
 // InitLedger adds a base set of consents to the ledger
@@ -34,7 +86,7 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 	}
 
 	for _, consent := range consents {
-		consentJSON, err := json.Marshal(consent)
+		consentJSON, err := marshalConsent(&consent)
 		if err != nil {
 			return err
 		}
@@ -48,8 +100,124 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 	return nil
 }
 
-// CreateConsent issues a new consent to the world state with given details.
-func (s *SmartContract) CreateConsent(ctx contractapi.TransactionContextInterface, id string, userId string, service string, provider string, consentGiven bool, timestamp string, expirationDate string, purpose string) error {
+// CreateConsent issues a new consent to the world state with given details. The collection method
+// records how the consent was obtained and must be one of the allowed collection methods; the terms
+// version names the policy text the user agreed to and must be currently active. Consents for
+// age-restricted services are rejected unless ageVerified is set.
+// A consent given while the user already has an active one for the same service, provider and
+// purpose is rejected as a duplicate unless forceCreate is set, e.g. for a deliberate re-consent.
+// The expiration date must be after the transaction time unless an admin passes the
+// allowPastExpiration transient override for historical imports. An empty expiration date falls
+// back to the provider's, then the global, default expiry days. A ConsentCreated event carries the
+// new consent's ID, user, provider and consentGiven flag, or a ConsentScheduled event its effective
+// date when it is not yet in effect.
+func (s *SmartContract) CreateConsent(ctx contractapi.TransactionContextInterface, id string, userId string, service string, provider string, consentGiven bool, timestamp string, expirationDate string, purpose string, collectionMethod string, termsVersion string, ageVerified bool, forceCreate bool) error {
+	exists, err := s.ConsentExists(ctx, id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the consent %s already exists", id)
+	}
+
+	consent, err := s.newConsent(ctx, &consentInput{
+		ID:               id,
+		UserID:           userId,
+		Service:          service,
+		Provider:         provider,
+		ConsentGiven:     consentGiven,
+		Timestamp:        timestamp,
+		ExpirationDate:   expirationDate,
+		Purpose:          purpose,
+		CollectionMethod: collectionMethod,
+		TermsVersion:     termsVersion,
+		AgeVerified:      ageVerified,
+		ForceCreate:      forceCreate,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = putConsent(ctx, consent)
+	if err != nil {
+		return err
+	}
+
+	return emitConsentCreated(ctx, consent)
+}
+
+// consentInput holds the fields a client may set when creating a consent, the same ones
+// CreateConsent takes. Batch functions decode their records into it, so system fields such as
+// signature, status, frozen or useCount can only ever be set by the contract itself.
+type consentInput struct {
+	ID               string `json:"id"`
+	UserID           string `json:"userId"`
+	Service          string `json:"service"`
+	Provider         string `json:"provider"`
+	ConsentGiven     bool   `json:"consentGiven"`
+	Timestamp        string `json:"timestamp"`
+	ExpirationDate   string `json:"expirationDate"`
+	Purpose          string `json:"purpose"`
+	CollectionMethod string `json:"collectionMethod"`
+	TermsVersion     string `json:"termsVersion"`
+	AgeVerified      bool   `json:"ageVerified"`
+	ForceCreate      bool   `json:"forceCreate"`
+}
+
+// newConsent builds the consent described by input and validates it the way CreateConsent does,
+// duplicate check included. It does not check whether the ID is already taken.
+func (s *SmartContract) newConsent(ctx contractapi.TransactionContextInterface, input *consentInput) (*Consent, error) {
+	consent := &Consent{
+		ID:               input.ID,
+		UserID:           input.UserID,
+		Service:          input.Service,
+		Provider:         input.Provider,
+		ConsentGiven:     input.ConsentGiven,
+		Timestamp:        input.Timestamp,
+		ExpirationDate:   input.ExpirationDate,
+		Purpose:          input.Purpose,
+		CollectionMethod: input.CollectionMethod,
+		TermsVersion:     input.TermsVersion,
+		AgeVerified:      input.AgeVerified,
+	}
+	err := validateNewConsent(ctx, consent)
+	if err != nil {
+		return nil, err
+	}
+	if consent.ConsentGiven && !input.ForceCreate {
+		err = s.assertNoActiveDuplicate(ctx, consent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return consent, nil
+}
+
+// decodeStrict unmarshals JSON into v, rejecting keys that v has no field for.
+func decodeStrict(data string, v interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// CreateConsentAuthoritativeTime is CreateConsent with the stored timestamp taken from the
+// transaction timestamp, in RFC3339 UTC form, rather than from the client, so a consent cannot be
+// backdated. Every endorser sees the same transaction timestamp, so the write is deterministic.
+// CreateConsent remains for migrations that must keep the original timestamps.
+func (s *SmartContract) CreateConsentAuthoritativeTime(ctx contractapi.TransactionContextInterface, id string, userId string, service string, provider string, consentGiven bool, expirationDate string, purpose string, collectionMethod string, termsVersion string, ageVerified bool, forceCreate bool) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.CreateConsent(ctx, id, userId, service, provider, consentGiven, now.UTC().Format(time.RFC3339), expirationDate, purpose, collectionMethod, termsVersion, ageVerified, forceCreate)
+}
+
+// CreateOptOut records that the user explicitly refused consent for the service and provider. An
+// opt-out is stored as a consent with ConsentGiven false and status "opted-out", which reporting can
+// tell apart from users who were never asked and therefore have no record at all.
+func (s *SmartContract) CreateOptOut(ctx contractapi.TransactionContextInterface, id string, userId string, service string, provider string, timestamp string, expirationDate string, purpose string, collectionMethod string, termsVersion string) error {
 	exists, err := s.ConsentExists(ctx, id)
 	if err != nil {
 		return err
@@ -59,21 +227,24 @@ func (s *SmartContract) CreateConsent(ctx contractapi.TransactionContextInterfac
 	}
 
 	consent := Consent{
-		ID:             id,
-		UserID:         userId,
-		Service:        service,
-		Provider:       provider,
-		ConsentGiven:   consentGiven,
-		Timestamp:      timestamp,
-		ExpirationDate: expirationDate,
-		Purpose:        purpose,
+		ID:               id,
+		UserID:           userId,
+		Service:          service,
+		Provider:         provider,
+		ConsentGiven:     false,
+		Timestamp:        timestamp,
+		ExpirationDate:   expirationDate,
+		Purpose:          purpose,
+		CollectionMethod: collectionMethod,
+		TermsVersion:     termsVersion,
+		OptedOut:         true,
 	}
-	consentJSON, err := json.Marshal(consent)
+	err = validateNewConsent(ctx, &consent)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, consentJSON)
+	return putConsent(ctx, &consent)
 }
 
 // ReadConsent returns the consent stored in the world state with given id.
@@ -95,46 +266,279 @@ func (s *SmartContract) ReadConsent(ctx contractapi.TransactionContextInterface,
 	return &consent, nil
 }
 
-// UpdateConsent updates an existing consent in the world state with provided parameters.
+// ConsentBatch is the result of GetConsentsByIDs: the consents found, in request order, and the
+// requested IDs that do not exist
+type ConsentBatch struct {
+	Consents []*Consent `json:"consents"`
+	NotFound []string   `json:"notFound"`
+}
+
+// GetConsentsByIDs reads the consents with the IDs in a JSON array in a single call. Missing IDs are
+// not an error; they are listed in NotFound instead.
+func (s *SmartContract) GetConsentsByIDs(ctx contractapi.TransactionContextInterface, idsJSON string) (*ConsentBatch, error) {
+	var ids []string
+	err := json.Unmarshal([]byte(idsJSON), &ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ids: %v", err)
+	}
+
+	batch := &ConsentBatch{Consents: []*Consent{}, NotFound: []string{}}
+	for _, id := range ids {
+		consentJSON, err := ctx.GetStub().GetState(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if consentJSON == nil {
+			batch.NotFound = append(batch.NotFound, id)
+			continue
+		}
+
+		var consent Consent
+		err = json.Unmarshal(consentJSON, &consent)
+		if err != nil {
+			return nil, err
+		}
+		batch.Consents = append(batch.Consents, &consent)
+	}
+
+	return batch, nil
+}
+
+// ConsentFull is a stored consent together with its status evaluated at the transaction timestamp
+type ConsentFull struct {
+	Consent         Consent `json:"consent"`
+	EvaluatedStatus string  `json:"evaluatedStatus"`
+	Exhausted       bool    `json:"exhausted"`
+	DaysUntilExpiry int     `json:"daysUntilExpiry"`
+	EvaluatedAt     string  `json:"evaluatedAt"`
+}
+
+// ReadConsentFull returns the stored consent along with its effective status, whether it has used
+// up its allowed number of uses, the number of whole days until it expires (negative once expired)
+// and the transaction timestamp used for evaluation.
+func (s *SmartContract) ReadConsentFull(ctx contractapi.TransactionContextInterface, id string) (*ConsentFull, error) {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	full := &ConsentFull{
+		Consent:         *consent,
+		EvaluatedStatus: consentStatus(consent, now),
+		Exhausted:       exhausted(consent),
+		EvaluatedAt:     now.UTC().Format(time.RFC3339),
+	}
+	expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+	if err == nil {
+		full.DaysUntilExpiry = daysUntil(expiration, now)
+	}
+
+	return full, nil
+}
+
+// LocalizedConsent is a consent together with the display label of its purpose in a locale
+type LocalizedConsent struct {
+	Consent      Consent `json:"consent"`
+	Locale       string  `json:"locale"`
+	PurposeLabel string  `json:"purposeLabel"`
+}
+
+// GetConsentLocalized returns the consent with its purpose label for the given locale, falling
+// back to the raw purpose when no label has been configured.
+func (s *SmartContract) GetConsentLocalized(ctx contractapi.TransactionContextInterface, id string, locale string) (*LocalizedConsent, error) {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := s.GetPurposeLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	label, ok := labels[consent.Purpose][locale]
+	if !ok {
+		label = consent.Purpose
+	}
+
+	return &LocalizedConsent{Consent: *consent, Locale: locale, PurposeLabel: label}, nil
+}
+
+// UpdateConsent updates an existing consent in the world state with provided parameters. The
+// provider is trimmed and must be one of the allowed providers, the expiration date must be after
+// the timestamp, and the caller must belong to the organization that created the consent and be an
+// admin for both the current and the new provider. The old values of the fields that changed are
+// kept in PreviousValues, giving a one-step-back view of the record, and a ConsentUpdated event is
+// emitted.
+//
+// Concurrent updates of the same consent are serialized by Fabric's MVCC validation rather than by
+// the chaincode: the consent key is in the read set of every update, so when two transactions
+// endorsed against the same version are ordered into blocks, only the first commits and the second
+// is marked MVCC_READ_CONFLICT with none of its writes, index entries included, applied. Clients
+// must check the validation code of the committed transaction and resubmit on conflict; they cannot
+// rely on the endorsement response alone.
 func (s *SmartContract) UpdateConsent(ctx contractapi.TransactionContextInterface, id string, userId string, service string, provider string, consentGiven bool, timestamp string, expirationDate string, purpose string) error {
-	exists, err := s.ConsentExists(ctx, id)
+	provider, err := normalizeProvider(provider)
+	if err != nil {
+		return err
+	}
+	existing, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = assertOwnerMSP(ctx, existing)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the consent %s does not exist", id)
+	err = assertProviderAdmin(ctx, existing.Provider)
+	if err != nil {
+		return err
+	}
+	if provider != existing.Provider {
+		err = assertProviderAdmin(ctx, provider)
+		if err != nil {
+			return err
+		}
+	}
+	// records that predate the service-provider matrix stay editable until they are moved
+	if service != existing.Service || provider != existing.Provider {
+		err = validateServiceForProvider(ctx, service, provider)
+		if err != nil {
+			return err
+		}
 	}
 
-	// overwriting original consent with new consent
-	consent := Consent{
-		ID:             id,
-		UserID:         userId,
-		Service:        service,
-		Provider:       provider,
-		ConsentGiven:   consentGiven,
-		Timestamp:      timestamp,
-		ExpirationDate: expirationDate,
-		Purpose:        purpose,
+	// overwriting the caller-supplied fields of the original consent, keeping its links and metadata
+	consent := *existing
+	consent.PreviousValues = changedFields(existing, map[string]string{
+		"userId":         userId,
+		"service":        service,
+		"provider":       provider,
+		"consentGiven":   strconv.FormatBool(consentGiven),
+		"timestamp":      timestamp,
+		"expirationDate": expirationDate,
+		"purpose":        purpose,
+	})
+	consent.UserID = userId
+	consent.Service = service
+	consent.Provider = provider
+	consent.ConsentGiven = consentGiven
+	consent.Timestamp = timestamp
+	consent.ExpirationDate = expirationDate
+	consent.Purpose = purpose
+	if consentGiven {
+		consent.OptedOut = false
+	}
+
+	err = validateConsentDates(&consent)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	err = assertTransition(existing, consentStatus(&consent, now), now)
+	if err != nil {
+		return err
+	}
+
+	err = putConsent(ctx, &consent)
+	if err != nil {
+		return err
 	}
-	consentJSON, err := json.Marshal(consent)
+
+	return emitConsentChanged(ctx, "ConsentUpdated", &consent)
+}
+
+// consentPatch holds the fields PatchConsent may change, the same ones UpdateConsent takes.
+type consentPatch struct {
+	UserID         string `json:"userId"`
+	Service        string `json:"service"`
+	Provider       string `json:"provider"`
+	ConsentGiven   bool   `json:"consentGiven"`
+	Timestamp      string `json:"timestamp"`
+	ExpirationDate string `json:"expirationDate"`
+	Purpose        string `json:"purpose"`
+}
+
+// PatchConsent applies a partial JSON object to a consent: only the keys present in patchJSON are
+// changed, the rest keep their stored values. The merged consent goes through UpdateConsent, with
+// the same validation, permission checks and ConsentUpdated event. Keys other than those
+// UpdateConsent takes, including system fields such as status, are rejected.
+func (s *SmartContract) PatchConsent(ctx contractapi.TransactionContextInterface, id string, patchJSON string) error {
+	existing, err := s.ReadConsent(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, consentJSON)
+	patch := consentPatch{
+		UserID:         existing.UserID,
+		Service:        existing.Service,
+		Provider:       existing.Provider,
+		ConsentGiven:   existing.ConsentGiven,
+		Timestamp:      existing.Timestamp,
+		ExpirationDate: existing.ExpirationDate,
+		Purpose:        existing.Purpose,
+	}
+	err = decodeStrict(patchJSON, &patch)
+	if err != nil {
+		return fmt.Errorf("failed to parse patch: %v", err)
+	}
+
+	return s.UpdateConsent(ctx, id, patch.UserID, patch.Service, patch.Provider, patch.ConsentGiven, patch.Timestamp, patch.ExpirationDate, patch.Purpose)
+}
+
+// changedFields returns the old values of the fields whose new value differs from the consent's.
+func changedFields(consent *Consent, updated map[string]string) map[string]string {
+	current := map[string]string{
+		"userId":         consent.UserID,
+		"service":        consent.Service,
+		"provider":       consent.Provider,
+		"consentGiven":   strconv.FormatBool(consent.ConsentGiven),
+		"timestamp":      consent.Timestamp,
+		"expirationDate": consent.ExpirationDate,
+		"purpose":        consent.Purpose,
+	}
+
+	var previous map[string]string
+	for field, value := range updated {
+		if current[field] == value {
+			continue
+		}
+		if previous == nil {
+			previous = make(map[string]string)
+		}
+		previous[field] = current[field]
+	}
+
+	return previous
 }
 
-// DeleteConsent deletes a given consent from the world state.
+// DeleteConsent deletes a given consent from the world state and emits a ConsentDeleted event. The
+// caller must belong to the organization that created it and be an admin for its provider.
 func (s *SmartContract) DeleteConsent(ctx contractapi.TransactionContextInterface, id string) error {
-	exists, err := s.ConsentExists(ctx, id)
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = assertOwnerMSP(ctx, consent)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the consent %s does not exist", id)
+	err = assertProviderAdmin(ctx, consent.Provider)
+	if err != nil {
+		return err
+	}
+	err = deleteConsent(ctx, consent)
+	if err != nil {
+		return err
 	}
 
-	return ctx.GetStub().DelState(id)
+	return emitEvent(ctx, "ConsentDeleted", consentDeleted{ID: consent.ID, UserID: consent.UserID})
 }
 
 // ConsentExists returns true when consent with given ID exists in world state
@@ -175,27 +579,27 @@ func (s *SmartContract) GetAllConsents(ctx contractapi.TransactionContextInterfa
 	return consents, nil
 }
 
-// GetConsentsByProvider returns all consents for a specific provider (JIO or Airtel)
-func (s *SmartContract) GetConsentsByProvider(ctx contractapi.TransactionContextInterface, provider string) ([]*Consent, error) {
-	queryString := fmt.Sprintf(`{"selector":{"provider":"%s"}}`, provider)
-	return getQueryResultForQueryString(ctx, queryString)
+// PagedConsentResult is one page of consents. An empty Bookmark means there are no further pages
+type PagedConsentResult struct {
+	Consents            []*Consent `json:"consents"`
+	Bookmark            string     `json:"bookmark"`
+	FetchedRecordsCount int32      `json:"fetchedRecordsCount"`
 }
 
-// GetConsentsByUser returns all consents for a specific user
-func (s *SmartContract) GetConsentsByUser(ctx contractapi.TransactionContextInterface, userId string) ([]*Consent, error) {
-	queryString := fmt.Sprintf(`{"selector":{"userId":"%s"}}`, userId)
-	return getQueryResultForQueryString(ctx, queryString)
-}
+// GetAllConsentsWithPagination returns one page of at most pageSize consents from the world state.
+// Pass the bookmark of the previous page to fetch the next one, starting with an empty bookmark.
+func (s *SmartContract) GetAllConsentsWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PagedConsentResult, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("pageSize must be positive, got %d", pageSize)
+	}
 
-// getQueryResultForQueryString executes the passed in query string.
-func getQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) ([]*Consent, error) {
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByRangeWithPagination("", "", pageSize, bookmark)
 	if err != nil {
 		return nil, err
 	}
 	defer resultsIterator.Close()
 
-	var consents []*Consent
+	consents := []*Consent{}
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
@@ -210,16 +614,704 @@ func getQueryResultForQueryString(ctx contractapi.TransactionContextInterface, q
 		consents = append(consents, &consent)
 	}
 
-	return consents, nil
+	result := &PagedConsentResult{Consents: consents, FetchedRecordsCount: metadata.FetchedRecordsCount}
+	// a short page is the last one, even though the peer still returns a bookmark for it
+	if metadata.FetchedRecordsCount == pageSize {
+		result.Bookmark = metadata.Bookmark
+	}
+
+	return result, nil
 }
 
-func main() {
-	consentChaincode, err := contractapi.NewChaincode(&SmartContract{})
+// forEachConsent calls fn for every consent in the world state without building the full result set.
+func forEachConsent(ctx contractapi.TransactionContextInterface, fn func(*Consent) error) error {
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
 	if err != nil {
-		log.Panicf("Error creating consent chaincode: %v", err)
+		return err
 	}
+	defer resultsIterator.Close()
 
-	if err := consentChaincode.Start(); err != nil {
-		log.Panicf("Error starting consent chaincode: %v", err)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		var consent Consent
+		err = json.Unmarshal(queryResponse.Value, &consent)
+		if err != nil {
+			return err
+		}
+		err = fn(&consent)
+		if err != nil {
+			return err
+		}
 	}
-}
\ No newline at end of file
+
+	return nil
+}
+
+// putConsent writes the consent to the world state under its ID, keeping the secondary indexes in
+// step with any previously stored version. Before writing it upgrades the consent to the current
+// schema version, normalizes its expiration date to UTC and stamps the derived fields: effective
+// status, dedup key, provenance (the creator is kept from the stored version) and, when it has just
+// been withdrawn, the revoking transaction. Consents under legal hold are rejected.
+func putConsent(ctx contractapi.TransactionContextInterface, consent *Consent) error {
+	return writeConsent(ctx, consent, false)
+}
+
+// writeConsent implements putConsent. releaseHold lets UnfreezeConsent write a consent that is
+// currently under legal hold.
+func writeConsent(ctx contractapi.TransactionContextInterface, consent *Consent, releaseHold bool) error {
+	_, err := migrateConsent(consent)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	consent.ExpirationDate = normalizeConsentDate(consent.ExpirationDate)
+	consent.DedupKey = dedupKey(consent)
+	consent.UpdatedBy, err = callerID(ctx)
+	if err != nil {
+		return err
+	}
+	consent.UpdaterMSP, err = callerMSPID(ctx)
+	if err != nil {
+		return err
+	}
+
+	previousJSON, err := ctx.GetStub().GetState(consent.ID)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	var previous *Consent
+	if previousJSON != nil {
+		previous = &Consent{}
+		err = json.Unmarshal(previousJSON, previous)
+		if err != nil {
+			return err
+		}
+		if !releaseHold {
+			err = assertNotFrozen(previous)
+			if err != nil {
+				return err
+			}
+		}
+		consent.CreatedBy = previous.CreatedBy
+		consent.CreatorMSP = previous.CreatorMSP
+	} else {
+		consent.CreatedBy = consent.UpdatedBy
+		consent.CreatorMSP = consent.UpdaterMSP
+	}
+
+	if previous != nil && previous.ConsentGiven && !consent.ConsentGiven && consent.Status == previous.Status {
+		// withdrawn without SetConsentStatus choosing a status: the stale stored one must not stick
+		consent.Status = ""
+	}
+	consent.Status = consentStatus(consent, now)
+	if previous != nil && previous.ConsentGiven && consent.Status == statusRevoked {
+		consent.RevocationTxID = ctx.GetStub().GetTxID()
+		if consent.RevokedAt == "" || consent.RevokedAt == previous.RevokedAt {
+			consent.RevokedAt = now.UTC().Format(time.RFC3339)
+		}
+	}
+
+	err = updateConsentIndexes(ctx, previous, consent)
+	if err != nil {
+		return err
+	}
+
+	consentJSON, err := marshalConsent(consent)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(consent.ID, consentJSON)
+}
+
+// marshalConsent is the canonical serialization every stored consent goes through. Endorsing peers
+// must produce byte-identical write sets, and encoding/json guarantees that: struct fields are
+// written in declaration order and map keys, as in ExternalRefs and Metadata, in sorted order.
+func marshalConsent(consent *Consent) ([]byte, error) {
+	return json.Marshal(consent)
+}
+
+// deleteConsent removes the consent and its secondary index entries from the world state, leaving a
+// tombstone so that the deleted key can still be found for history queries. The private details of
+// consents created by CreateConsentPrivate are deleted too. Consents under legal hold are rejected.
+func deleteConsent(ctx contractapi.TransactionContextInterface, consent *Consent) error {
+	err := assertNotFrozen(consent)
+	if err != nil {
+		return err
+	}
+	err = updateConsentIndexes(ctx, consent, nil)
+	if err != nil {
+		return err
+	}
+	tombstone, err := ctx.GetStub().CreateCompositeKey(tombstoneIndex, []string{consent.ID})
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(tombstone, indexValue)
+	if err != nil {
+		return err
+	}
+	if consent.PrivateDataHash != "" {
+		err = ctx.GetStub().DelPrivateData(privateConsentCollection, consent.ID)
+		if err != nil {
+			return fmt.Errorf("failed to delete private data: %v", err)
+		}
+	}
+
+	return ctx.GetStub().DelState(consent.ID)
+}
+
+// GetConsentsByProvider returns all consents for a specific provider (JIO or Airtel)
+func (s *SmartContract) GetConsentsByProvider(ctx contractapi.TransactionContextInterface, provider string) ([]*Consent, error) {
+	provider, err := normalizeProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+	queryString := fmt.Sprintf(`{"selector":{"provider":"%s"}}`, provider)
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// GetConsentsByProviderLevelDB returns all consents for a specific provider from the
+// provider~user~id composite key index rather than a rich query, so it also works on peers using
+// the LevelDB state database. Consents written before the index existed appear once
+// MigrateAllConsents has been run.
+func (s *SmartContract) GetConsentsByProviderLevelDB(ctx contractapi.TransactionContextInterface, provider string) ([]*Consent, error) {
+	provider, err := normalizeProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := getConsentIDsByProvider(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	consents := []*Consent{}
+	for _, id := range ids {
+		consent, err := s.ReadConsent(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		consents = append(consents, consent)
+	}
+
+	return consents, nil
+}
+
+// GetConsentsByProviderWithPagination returns one page of at most pageSize consents for a specific
+// provider. Pass the bookmark of the previous page to fetch the next one, starting with an empty
+// bookmark.
+func (s *SmartContract) GetConsentsByProviderWithPagination(ctx contractapi.TransactionContextInterface, provider string, pageSize int32, bookmark string) (*PagedConsentResult, error) {
+	provider, err := normalizeProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+	queryString := fmt.Sprintf(`{"selector":{"provider":"%s"}}`, provider)
+	return getPagedQueryResultForQueryString(ctx, queryString, pageSize, bookmark)
+}
+
+// GetConsentIDsByProvider returns only the IDs of the consents for a specific provider. The query
+// asks CouchDB for no document fields and takes each ID from the result key, which is much cheaper
+// than GetConsentsByProvider when the client fetches details separately.
+func (s *SmartContract) GetConsentIDsByProvider(ctx contractapi.TransactionContextInterface, provider string) ([]string, error) {
+	provider, err := normalizeProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+	queryString := fmt.Sprintf(`{"selector":{"provider":"%s"},"fields":["id"]}`, provider)
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	ids := []string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !isLiveConsentKey(queryResponse.Key) {
+			continue
+		}
+		ids = append(ids, queryResponse.Key)
+	}
+
+	return ids, nil
+}
+
+// GetConsentsByStatusPaginated returns one page of the consents with the given status. It queries
+// the materialized Status field rather than evaluating each consent, so a consent shows up under
+// the status it had when it was last written or when MaterializeStatuses last ran; run that job
+// before loading views where expiry must be exact.
+func (s *SmartContract) GetConsentsByStatusPaginated(ctx contractapi.TransactionContextInterface, status string, pageSize int32, bookmark string) (*PagedConsentResult, error) {
+	if _, ok := allowedTransitions[status]; !ok {
+		return nil, fmt.Errorf("unknown status %q", status)
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"status":"%s"}}`, status)
+	return getPagedQueryResultForQueryString(ctx, queryString, pageSize, bookmark)
+}
+
+// GetConsentsExpiringBefore returns all consents whose ExpirationDate is before the cutoff date,
+// compared by CouchDB as strings. That is only chronological because expiration dates are ISO 8601:
+// putConsent stores them either date-only or as RFC3339 in UTC, and the cutoff is normalized the
+// same way. Records written before normalization was introduced may carry other offsets and are
+// only compared correctly once they have been rewritten.
+func (s *SmartContract) GetConsentsExpiringBefore(ctx contractapi.TransactionContextInterface, cutoffDate string) ([]*Consent, error) {
+	_, err := parseConsentDate("cutoffDate", cutoffDate)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"expirationDate":{"$lt":"%s"}}}`, normalizeConsentDate(cutoffDate))
+	consents, err := getQueryResultForQueryString(ctx, queryString)
+	if err != nil {
+		return nil, err
+	}
+	if consents == nil {
+		consents = []*Consent{}
+	}
+
+	return consents, nil
+}
+
+// GetConsentsByProviders returns all consents for any of the providers in a JSON array
+func (s *SmartContract) GetConsentsByProviders(ctx contractapi.TransactionContextInterface, providersJSON string) ([]*Consent, error) {
+	var providers []string
+	err := json.Unmarshal([]byte(providersJSON), &providers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse providers: %v", err)
+	}
+	for i, provider := range providers {
+		providers[i], err = normalizeProvider(provider)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(providers) == 0 {
+		return []*Consent{}, nil
+	}
+
+	providersList, err := json.Marshal(providers)
+	if err != nil {
+		return nil, err
+	}
+	queryString := fmt.Sprintf(`{"selector":{"provider":{"$in":%s}}}`, providersList)
+	consents, err := getQueryResultForQueryString(ctx, queryString)
+	if err != nil {
+		return nil, err
+	}
+	if consents == nil {
+		consents = []*Consent{}
+	}
+
+	return consents, nil
+}
+
+// GetConsentsByProviderLimited returns at most limit consents for a specific provider, for previews
+// that do not need a full result set or pagination.
+func (s *SmartContract) GetConsentsByProviderLimited(ctx contractapi.TransactionContextInterface, provider string, limit int) ([]*Consent, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	provider, err := normalizeProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"provider":"%s"}}`, provider)
+	return getLimitedQueryResultForQueryString(ctx, queryString, limit)
+}
+
+// GetMyConsents returns the consents of the calling user, identified by the userId attribute of
+// the client identity, so end-user apps never pass a user ID they could tamper with.
+func (s *SmartContract) GetMyConsents(ctx contractapi.TransactionContextInterface) ([]*Consent, error) {
+	userId, err := callerUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	consents, err := s.GetConsentsByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if consents == nil {
+		consents = []*Consent{}
+	}
+
+	return consents, nil
+}
+
+// GetActiveConsentsByUser returns the consents of a user that are in effect at the transaction
+// timestamp: given, not yet effective-dated into the future, and with an ExpirationDate on or after
+// the transaction time. Dates are RFC3339 ("2024-01-01T00:00:00Z") or date-only ("2024-01-01"),
+// the latter meaning midnight UTC at the start of that day. Consents whose ExpirationDate cannot be
+// parsed are treated as inactive and skipped.
+func (s *SmartContract) GetActiveConsentsByUser(ctx contractapi.TransactionContextInterface, userId string) ([]*Consent, error) {
+	consents, err := s.GetConsentsByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	active := []*Consent{}
+	for _, consent := range consents {
+		if isActive(consent, now) {
+			active = append(active, consent)
+		}
+	}
+
+	return active, nil
+}
+
+// GetConsentsByCreator returns all consents created by the given client identity ID, e.g. to review
+// an operator's work during a fraud investigation. Only admins may call it.
+func (s *SmartContract) GetConsentsByCreator(ctx contractapi.TransactionContextInterface, creatorId string) ([]*Consent, error) {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"createdBy":"%s"}}`, creatorId)
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// GetConsentsByUser returns all consents for a specific user
+func (s *SmartContract) GetConsentsByUser(ctx contractapi.TransactionContextInterface, userId string) ([]*Consent, error) {
+	queryString := fmt.Sprintf(`{"selector":{"userId":"%s"}}`, userId)
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// GetConsentsByUserWithStatus returns the consents of a specific user whose consentGiven flag
+// matches, e.g. only the granted or only the withdrawn ones. The flag alone does not tell whether a
+// granted consent has since expired.
+func (s *SmartContract) GetConsentsByUserWithStatus(ctx contractapi.TransactionContextInterface, userId string, consentGiven bool) ([]*Consent, error) {
+	queryString := fmt.Sprintf(`{"selector":{"userId":"%s","consentGiven":%t}}`, userId, consentGiven)
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// GetConsentsByUserWithPagination returns one page of at most pageSize consents for a specific user.
+// Pass the bookmark of the previous page to fetch the next one, starting with an empty bookmark.
+func (s *SmartContract) GetConsentsByUserWithPagination(ctx contractapi.TransactionContextInterface, userId string, pageSize int32, bookmark string) (*PagedConsentResult, error) {
+	queryString := fmt.Sprintf(`{"selector":{"userId":"%s"}}`, userId)
+	return getPagedQueryResultForQueryString(ctx, queryString, pageSize, bookmark)
+}
+
+// GetConsentsByPurpose returns all consents for a specific purpose
+func (s *SmartContract) GetConsentsByPurpose(ctx contractapi.TransactionContextInterface, purpose string) ([]*Consent, error) {
+	queryString := fmt.Sprintf(`{"selector":{"purpose":"%s"}}`, purpose)
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// GetConsentsByUserAndPurpose returns all consents of a specific user for a specific purpose
+func (s *SmartContract) GetConsentsByUserAndPurpose(ctx contractapi.TransactionContextInterface, userId string, purpose string) ([]*Consent, error) {
+	queryString := fmt.Sprintf(`{"selector":{"userId":"%s","purpose":"%s"}}`, userId, purpose)
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// GetConsentsByServiceAndProvider returns all consents for a specific service with a specific
+// provider. Both must be given; an empty one would otherwise match every consent.
+func (s *SmartContract) GetConsentsByServiceAndProvider(ctx contractapi.TransactionContextInterface, service string, provider string) ([]*Consent, error) {
+	if service == "" || provider == "" {
+		return nil, fmt.Errorf("the service and provider must not be empty")
+	}
+	provider, err := normalizeProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"service":"%s","provider":"%s"}}`, service, provider)
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// ConsentVerification is the verdict of VerifyUserConsent. Reason is "active" for a valid consent,
+// otherwise one of "not-found", "wrong-user", "revoked", "opted-out", "expired", "pending" or
+// "exhausted".
+type ConsentVerification struct {
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason"`
+}
+
+// VerifyUserConsent checks in one call that the consent exists, belongs to the user and is active at
+// the transaction timestamp. Contract functions can only return a single value besides the error, so
+// the (valid, reason) pair is returned as a ConsentVerification.
+func (s *SmartContract) VerifyUserConsent(ctx contractapi.TransactionContextInterface, id string, userId string) (*ConsentVerification, error) {
+	consentJSON, err := ctx.GetStub().GetState(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if consentJSON == nil {
+		return &ConsentVerification{Reason: "not-found"}, nil
+	}
+	var consent Consent
+	err = json.Unmarshal(consentJSON, &consent)
+	if err != nil {
+		return nil, err
+	}
+	if consent.UserID != userId {
+		return &ConsentVerification{Reason: "wrong-user"}, nil
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := consentStatus(&consent, now)
+	if status == statusActive && exhausted(&consent) {
+		return &ConsentVerification{Reason: "exhausted"}, nil
+	}
+
+	return &ConsentVerification{Valid: status == statusActive, Reason: status}, nil
+}
+
+// GetConsentsByTag returns all consents carrying the given tag
+func (s *SmartContract) GetConsentsByTag(ctx contractapi.TransactionContextInterface, tag string) ([]*Consent, error) {
+	queryString := fmt.Sprintf(`{"selector":{"tags":{"$elemMatch":{"$eq":"%s"}}}}`, tag)
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// GetConsentsByCollectionMethod returns all consents collected through the given channel
+func (s *SmartContract) GetConsentsByCollectionMethod(ctx contractapi.TransactionContextInterface, method string) ([]*Consent, error) {
+	queryString := fmt.Sprintf(`{"selector":{"collectionMethod":"%s"}}`, method)
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// GetConsentsByTermsVersion returns all consents given under the given version of the terms
+func (s *SmartContract) GetConsentsByTermsVersion(ctx contractapi.TransactionContextInterface, version string) ([]*Consent, error) {
+	queryString := fmt.Sprintf(`{"selector":{"termsVersion":"%s"}}`, version)
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// GetConsentsByRetentionCategory returns all consents in the given retention category
+func (s *SmartContract) GetConsentsByRetentionCategory(ctx contractapi.TransactionContextInterface, category string) ([]*Consent, error) {
+	queryString := fmt.Sprintf(`{"selector":{"retentionCategory":"%s"}}`, category)
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// GetOptOuts returns all consents the users explicitly refused
+func (s *SmartContract) GetOptOuts(ctx contractapi.TransactionContextInterface) ([]*Consent, error) {
+	return getQueryResultForQueryString(ctx, `{"selector":{"optedOut":true}}`)
+}
+
+// HasActiveConsent returns true when the user has a consent for the service and provider that is
+// granted, past its EffectiveFrom and not yet expired at the transaction timestamp.
+func (s *SmartContract) HasActiveConsent(ctx contractapi.TransactionContextInterface, userId string, service string, provider string) (bool, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"userId":"%s","service":"%s","provider":"%s"}}`, userId, service, provider)
+	consents, err := getQueryResultForQueryString(ctx, queryString)
+	if err != nil {
+		return false, err
+	}
+	for _, consent := range consents {
+		if isActive(consent, now) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// IsConsentActive reports whether the consent is in effect at the transaction timestamp: granted,
+// past its EffectiveFrom, not yet expired and not used up. It applies the same rules as every other
+// status check in the contract. A consent that does not exist is reported inactive rather than as
+// an error.
+func (s *SmartContract) IsConsentActive(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	consentJSON, err := ctx.GetStub().GetState(id)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if consentJSON == nil {
+		return false, nil
+	}
+
+	var consent Consent
+	err = json.Unmarshal(consentJSON, &consent)
+	if err != nil {
+		return false, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return isActive(&consent, now), nil
+}
+
+// GetProviderConsentsByExpiryRange returns the provider's consents whose expiration falls within
+// [startDate, endDate]. A date-only endDate includes the whole of that day.
+func (s *SmartContract) GetProviderConsentsByExpiryRange(ctx contractapi.TransactionContextInterface, provider string, startDate string, endDate string) ([]*Consent, error) {
+	start, end, err := parseDateRange(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"provider":"%s"}}`, provider)
+	consents, err := getQueryResultForQueryString(ctx, queryString)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []*Consent{}
+	for _, consent := range consents {
+		expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+		if err != nil {
+			continue
+		}
+		if !expiration.Before(start) && !expiration.After(end) {
+			matching = append(matching, consent)
+		}
+	}
+
+	return matching, nil
+}
+
+// GetConsentsByDateRange returns the consents whose creation timestamp falls within
+// [startDate, endDate]. A date-only endDate includes the whole of that day. Timestamps are stored as
+// given, date-only or with any UTC offset, so the CouchDB selector compares them as strings against
+// bounds widened by a day on each side and the exact range is applied to the parsed timestamps.
+func (s *SmartContract) GetConsentsByDateRange(ctx contractapi.TransactionContextInterface, startDate string, endDate string) ([]*Consent, error) {
+	start, end, err := parseDateRange(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"timestamp":{"$gte":"%s","$lte":"%s"}}}`,
+		start.UTC().AddDate(0, 0, -1).Format("2006-01-02"), end.UTC().AddDate(0, 0, 2).Format("2006-01-02"))
+	consents, err := getQueryResultForQueryString(ctx, queryString)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []*Consent{}
+	for _, consent := range consents {
+		created, err := parseConsentDate("timestamp", consent.Timestamp)
+		if err != nil {
+			continue
+		}
+		if !created.Before(start) && !created.After(end) {
+			matching = append(matching, consent)
+		}
+	}
+
+	return matching, nil
+}
+
+// getQueryResultForQueryString executes the passed in query string.
+func getQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) ([]*Consent, error) {
+	return getLimitedQueryResultForQueryString(ctx, queryString, 0)
+}
+
+// getPagedQueryResultForQueryString executes the passed in query string and returns one page of at
+// most pageSize consents, with an empty bookmark once the last page has been returned.
+func getPagedQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string, pageSize int32, bookmark string) (*PagedConsentResult, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("pageSize must be positive, got %d", pageSize)
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	consents := []*Consent{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		consent, err := decodeQueryResult(queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		if consent == nil {
+			continue
+		}
+		consents = append(consents, consent)
+	}
+
+	result := &PagedConsentResult{Consents: consents, FetchedRecordsCount: metadata.FetchedRecordsCount}
+	if metadata.FetchedRecordsCount == pageSize {
+		result.Bookmark = metadata.Bookmark
+	}
+
+	return result, nil
+}
+
+// getLimitedQueryResultForQueryString executes the passed in query string and stops after limit
+// results. A limit of 0 returns every result.
+func getLimitedQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string, limit int) ([]*Consent, error) {
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var consents []*Consent
+	for resultsIterator.HasNext() && (limit == 0 || len(consents) < limit) {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		consent, err := decodeQueryResult(queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		if consent == nil {
+			continue
+		}
+		consents = append(consents, consent)
+	}
+
+	return consents, nil
+}
+
+// isLiveConsentKey reports whether a world state key holds a live consent. Composite keys start
+// with "\x00" and hold indexes, settings, audit records and archived consents. Range queries skip
+// them, but rich queries match them like any other document.
+func isLiveConsentKey(key string) bool {
+	return !strings.HasPrefix(key, "\x00")
+}
+
+// decodeQueryResult decodes a rich query result as a consent, returning nil for results that are
+// not live consents. Every rich query over consents decodes its results through it.
+func decodeQueryResult(key string, value []byte) (*Consent, error) {
+	if !isLiveConsentKey(key) {
+		return nil, nil
+	}
+
+	var consent Consent
+	err := json.Unmarshal(value, &consent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+func main() {
+	consentChaincode, err := contractapi.NewChaincode(&SmartContract{})
+	if err != nil {
+		log.Panicf("Error creating consent chaincode: %v", err)
+	}
+
+	if err := consentChaincode.Start(); err != nil {
+		log.Panicf("Error starting consent chaincode: %v", err)
+	}
+}
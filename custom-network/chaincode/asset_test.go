@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// testIdentity is a client identity with a fixed ID, MSP and set of attributes.
+type testIdentity struct {
+	id    string
+	mspID string
+	attrs map[string]string
+}
+
+func (i *testIdentity) GetID() (string, error) {
+	return i.id, nil
+}
+
+func (i *testIdentity) GetMSPID() (string, error) {
+	return i.mspID, nil
+}
+
+func (i *testIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := i.attrs[name]
+	return value, found, nil
+}
+
+func (i *testIdentity) AssertAttributeValue(name string, value string) error {
+	if i.attrs[name] != value {
+		return fmt.Errorf("attribute %s is not %s", name, value)
+	}
+	return nil
+}
+
+func (i *testIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+// queryStub answers rich queries, which the mock stub does not support, for selectors that only
+// test top-level fields for equality.
+type queryStub struct {
+	*shimtest.MockStub
+}
+
+func (s *queryStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	var q struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	err := json.Unmarshal([]byte(query), &q)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &resultsIterator{}
+	for elem := s.Keys.Front(); elem != nil; elem = elem.Next() {
+		key := elem.Value.(string)
+		var doc map[string]interface{}
+		if json.Unmarshal(s.State[key], &doc) != nil {
+			continue
+		}
+		matches := true
+		for field, want := range q.Selector {
+			if !reflect.DeepEqual(doc[field], want) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			results.kvs = append(results.kvs, &queryresult.KV{Key: key, Value: s.State[key]})
+		}
+	}
+
+	return results, nil
+}
+
+// resultsIterator iterates over a fixed list of query results.
+type resultsIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (i *resultsIterator) HasNext() bool {
+	return len(i.kvs) > 0
+}
+
+func (i *resultsIterator) Next() (*queryresult.KV, error) {
+	kv := i.kvs[0]
+	i.kvs = i.kvs[1:]
+	return kv, nil
+}
+
+func (i *resultsIterator) Close() error {
+	return nil
+}
+
+// testContext is a transaction context over a mock stub, so contract functions run without a peer.
+type testContext struct {
+	contractapi.TransactionContext
+	identity *testIdentity
+}
+
+func (c *testContext) GetClientIdentity() cid.ClientIdentity {
+	return c.identity
+}
+
+// newTestContext returns a context whose open transaction is timestamped now and submitted by an
+// admin of the JIO provider.
+func newTestContext(t *testing.T, now time.Time) (*testContext, *shimtest.MockStub) {
+	t.Helper()
+
+	stub := shimtest.NewMockStub("consent", nil)
+	stub.MockTransactionStart("tx1")
+	stub.TxTimestamp = timestamppb.New(now)
+
+	ctx := &testContext{identity: testAdmin()}
+	ctx.SetStub(&queryStub{stub})
+
+	return ctx, stub
+}
+
+// testAdmin returns the identity of an admin of the JIO provider.
+func testAdmin() *testIdentity {
+	return &testIdentity{
+		id:    "x509::CN=admin",
+		mspID: "Org1MSP",
+		attrs: map[string]string{providerAdminAttribute: "JIO"},
+	}
+}
+
+// endorsement simulates a transaction against the committed state of a mock stub: like a peer, it
+// records the value of every key read and holds the writes back until the transaction commits.
+type endorsement struct {
+	*shimtest.MockStub
+	reads  map[string][]byte
+	writes map[string][]byte
+}
+
+// endorse runs fn in a new transaction over the committed state of stub.
+func endorse(t *testing.T, stub *shimtest.MockStub, fn func(ctx *testContext) error) *endorsement {
+	t.Helper()
+
+	e := &endorsement{MockStub: stub, reads: map[string][]byte{}, writes: map[string][]byte{}}
+	ctx := &testContext{identity: testAdmin()}
+	ctx.SetStub(e)
+	err := fn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func (e *endorsement) GetState(key string) ([]byte, error) {
+	value := e.MockStub.State[key]
+	if _, read := e.reads[key]; !read {
+		e.reads[key] = value
+	}
+	return value, nil
+}
+
+func (e *endorsement) PutState(key string, value []byte) error {
+	e.writes[key] = value
+	return nil
+}
+
+func (e *endorsement) DelState(key string) error {
+	e.writes[key] = nil
+	return nil
+}
+
+// commit validates the transaction as Fabric's MVCC check does, failing it when a key it read has
+// changed since, and applies its writes only if it is valid.
+func (e *endorsement) commit() (bool, error) {
+	for key, value := range e.reads {
+		if !bytes.Equal(e.MockStub.State[key], value) {
+			return false, nil
+		}
+	}
+
+	keys := make([]string, 0, len(e.writes))
+	for key := range e.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// an empty value deletes the key
+		err := e.MockStub.PutState(key, e.writes[key])
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// testConsent returns a granted consent of user1 for the JIO data-sharing service, valid for a year
+// from now.
+func testConsent(id string, now time.Time) *Consent {
+	return &Consent{
+		ID:             id,
+		UserID:         "user1",
+		Service:        "data-sharing",
+		Provider:       "JIO",
+		ConsentGiven:   true,
+		Timestamp:      now.UTC().Format(time.RFC3339),
+		ExpirationDate: now.AddDate(1, 0, 0).UTC().Format(time.RFC3339),
+		Purpose:        "analytics",
+	}
+}
+
+func TestHasActiveConsentBoundaries(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	effectiveFrom := created.AddDate(0, 0, 1)
+	expiration := created.AddDate(0, 0, 30)
+	ctx, stub := newTestContext(t, created)
+	s := &SmartContract{}
+
+	consent := testConsent("consent1", created)
+	consent.EffectiveFrom = effectiveFrom.Format(time.RFC3339)
+	consent.ExpirationDate = expiration.Format(time.RFC3339)
+	err := putConsent(ctx, consent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a withdrawn consent for the same service must never count
+	revoked := testConsent("consent2", created)
+	revoked.ConsentGiven = false
+	err = putConsent(ctx, revoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"just before effective", effectiveFrom.Add(-time.Second), false},
+		{"at effective", effectiveFrom, true},
+		{"at expiry", expiration, true},
+		{"just after expiry", expiration.Add(time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub.TxTimestamp = timestamppb.New(tt.now)
+
+			got, err := s.HasActiveConsent(ctx, "user1", "data-sharing", "JIO")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("HasActiveConsent at %s = %t, want %t", tt.now.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateConsentMVCCConflicts(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	timestamp := now.Format(time.RFC3339)
+	expiration := now.AddDate(1, 0, 0).Format(time.RFC3339)
+	s := &SmartContract{}
+
+	update := func(id string, purpose string) func(ctx *testContext) error {
+		return func(ctx *testContext) error {
+			return s.UpdateConsent(ctx, id, "user1", "data-sharing", "JIO", true, timestamp, expiration, purpose)
+		}
+	}
+	remove := func(id string) func(ctx *testContext) error {
+		return func(ctx *testContext) error {
+			return s.DeleteConsent(ctx, id)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		first        func(ctx *testContext) error
+		second       func(ctx *testContext) error
+		wantCommit   bool
+		wantPurpose1 string
+	}{
+		{"same consent", update("consent1", "marketing"), update("consent1", "research"), false, "marketing"},
+		{"update and delete", update("consent1", "marketing"), remove("consent1"), false, "marketing"},
+		{"different consents", update("consent1", "marketing"), update("consent2", "research"), true, "marketing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stub := newTestContext(t, now)
+			for _, id := range []string{"consent1", "consent2"} {
+				err := putConsent(ctx, testConsent(id, now))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// both transactions are endorsed against the same committed state before either commits
+			first := endorse(t, stub, tt.first)
+			second := endorse(t, stub, tt.second)
+			committed, err := first.commit()
+			if err != nil || !committed {
+				t.Fatalf("first transaction did not commit: %v", err)
+			}
+			committed, err = second.commit()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if committed != tt.wantCommit {
+				t.Errorf("second transaction committed: %t, want %t", committed, tt.wantCommit)
+			}
+
+			var consent Consent
+			err = json.Unmarshal(stub.State["consent1"], &consent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if consent.Purpose != tt.wantPurpose1 {
+				t.Errorf("consent1 has purpose %q, want %q", consent.Purpose, tt.wantPurpose1)
+			}
+		})
+	}
+}
+
+func TestUpdateConsentRejectsExpirationBeforeTimestamp(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ctx, _ := newTestContext(t, now)
+	s := &SmartContract{}
+	err := putConsent(ctx, testConsent("consent1", now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.UpdateConsent(ctx, "consent1", "user1", "data-sharing", "JIO", true, "2023-01-01", "2020-01-01", "analytics")
+	if err == nil || !strings.Contains(err.Error(), "expirationDate") {
+		t.Errorf("UpdateConsent returned %v, want an expirationDate error", err)
+	}
+}
+func TestMarshalConsentIsDeterministic(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	first := testConsent("consent1", now)
+	first.ExternalRefs = map[string]string{}
+	for _, key := range []string{"crm", "billing", "support", "marketing"} {
+		first.ExternalRefs[key] = key + "-value"
+	}
+	second := testConsent("consent1", now)
+	second.ExternalRefs = map[string]string{}
+	for _, key := range []string{"marketing", "support", "billing", "crm"} {
+		second.ExternalRefs[key] = key + "-value"
+	}
+
+	firstJSON, err := marshalConsent(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondJSON, err := marshalConsent(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(firstJSON, secondJSON) {
+		t.Errorf("marshalConsent is not deterministic:\n%s\n%s", firstJSON, secondJSON)
+	}
+}
+
+func TestPutConsentRoundTrip(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ctx, stub := newTestContext(t, now)
+	s := &SmartContract{}
+
+	consent := testConsent("consent1", now)
+	consent.Tags = []string{"newsletter"}
+	consent.ExternalRefs = map[string]string{"crm": "C-1", "billing": "B-1"}
+	err := putConsent(ctx, consent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.ReadConsent(ctx, "consent1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored, consent) {
+		t.Errorf("read back %+v, want %+v", stored, consent)
+	}
+	if stored.Status != statusActive || stored.CreatedBy != "x509::CN=admin" || stored.CreatorMSP != "Org1MSP" {
+		t.Errorf("derived fields not stamped: status %q, createdBy %q, creatorMsp %q", stored.Status, stored.CreatedBy, stored.CreatorMSP)
+	}
+
+	storedJSON := stub.State["consent1"]
+	remarshaled, err := marshalConsent(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(storedJSON, remarshaled) {
+		t.Errorf("stored bytes differ from marshalConsent output:\n%s\n%s", storedJSON, remarshaled)
+	}
+
+	// writing the consent again unchanged must produce the same bytes
+	err = putConsent(ctx, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stub.State["consent1"], storedJSON) {
+		t.Errorf("rewriting an unchanged consent changed its bytes:\n%s\n%s", stub.State["consent1"], storedJSON)
+	}
+}
+
+func TestBulkUpsertConsentsRejectsRepeatedID(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	_, stub := newTestContext(t, now)
+	s := &SmartContract{}
+
+	record := func(key string, purpose string) map[string]interface{} {
+		return map[string]interface{}{
+			"idempotencyKey":   key,
+			"id":               "consent1",
+			"userId":           "user1",
+			"service":          "data-sharing",
+			"provider":         "JIO",
+			"consentGiven":     true,
+			"timestamp":        now.Format(time.RFC3339),
+			"expirationDate":   now.AddDate(1, 0, 0).Format(time.RFC3339),
+			"purpose":          purpose,
+			"collectionMethod": "web",
+			"termsVersion":     "privacy-policy-v1",
+			"forceCreate":      true,
+		}
+	}
+	recordsJSON, err := json.Marshal([]interface{}{record("k1", "analytics"), record("k2", "marketing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result *BulkResult
+	tx := endorse(t, stub, func(ctx *testContext) error {
+		var err error
+		result, err = s.BulkUpsertConsents(ctx, string(recordsJSON))
+		return err
+	})
+	if result.Succeeded != 1 || result.Failed != 1 || result.Outcomes[1].Status != outcomeFailed {
+		t.Fatalf("got %+v, want the second record failed", result)
+	}
+	committed, err := tx.commit()
+	if err != nil || !committed {
+		t.Fatalf("transaction did not commit: %v", err)
+	}
+
+	var consent Consent
+	err = json.Unmarshal(stub.State["consent1"], &consent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consent.Purpose != "analytics" {
+		t.Errorf("consent1 has purpose %q, want %q", consent.Purpose, "analytics")
+	}
+}
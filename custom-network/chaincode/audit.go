@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// expiryAuditObjectType is the composite key namespace of expiry change audit records, keyed by
+// consent ID and transaction ID. Composite keys are not returned by GetStateByRange, and the
+// records share no field names with consents, so consent selectors never match them either.
+const expiryAuditObjectType = "expiryAudit"
+
+// ExpiryChange is an audit record of a change to a consent's expiration date
+type ExpiryChange struct {
+	ConsentID     string `json:"consentId"`
+	OldExpiration string `json:"oldExpiration"`
+	NewExpiration string `json:"newExpiration"`
+	Actor         string `json:"actor"`
+	TxID          string `json:"txId"`
+	ChangedAt     string `json:"changedAt"`
+}
+
+// putExpiryChange writes the audit record of a change to a consent's expiration date made by the
+// current transaction. Records are never overwritten, and no function updates or deletes them.
+func putExpiryChange(ctx contractapi.TransactionContextInterface, consentId string, oldExpiration string, newExpiration string) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	actor, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+	txId := ctx.GetStub().GetTxID()
+
+	key, err := ctx.GetStub().CreateCompositeKey(expiryAuditObjectType, []string{consentId, txId})
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("the expiry audit record of consent %s for transaction %s already exists", consentId, txId)
+	}
+
+	changeJSON, err := json.Marshal(ExpiryChange{
+		ConsentID:     consentId,
+		OldExpiration: oldExpiration,
+		NewExpiration: newExpiration,
+		Actor:         actor,
+		TxID:          txId,
+		ChangedAt:     now.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, changeJSON)
+}
+
+// GetExpiryChangeHistory returns the audit records of the changes to a consent's expiration date,
+// oldest first.
+func (s *SmartContract) GetExpiryChangeHistory(ctx contractapi.TransactionContextInterface, id string) ([]*ExpiryChange, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(expiryAuditObjectType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	changes := []*ExpiryChange{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var change ExpiryChange
+		err = json.Unmarshal(queryResponse.Value, &change)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, &change)
+	}
+
+	// keys are ordered by transaction ID, which says nothing about when the change was made
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].ChangedAt < changes[j].ChangedAt
+	})
+
+	return changes, nil
+}
@@ -0,0 +1,671 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// idempotencyKeyObjectType is the composite key namespace recording applied import records.
+const idempotencyKeyObjectType = "idempotencyKey"
+
+// Per-record outcomes reported in a BulkResult.
+const (
+	outcomeCreated = "created"
+	outcomeUpdated = "updated"
+	outcomeDeleted = "deleted"
+	outcomeSkipped = "skipped"
+	outcomeFailed  = "failed"
+)
+
+// BulkResult reports the outcome of a batch operation record by record
+type BulkResult struct {
+	Succeeded int           `json:"succeeded"`
+	Skipped   int           `json:"skipped"`
+	Failed    int           `json:"failed"`
+	Outcomes  []BulkOutcome `json:"outcomes"`
+}
+
+// BulkOutcome describes what happened to a single record of a batch operation
+type BulkOutcome struct {
+	Index   int    `json:"index"`
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty" metadata:",optional"`
+}
+
+// newBulkResult returns an empty result ready for outcomes to be recorded.
+func newBulkResult() *BulkResult {
+	return &BulkResult{Outcomes: []BulkOutcome{}}
+}
+
+// record appends the outcome of one record and updates the totals.
+func (r *BulkResult) record(index int, id string, status string, message string) {
+	switch status {
+	case outcomeSkipped:
+		r.Skipped++
+	case outcomeFailed:
+		r.Failed++
+	default:
+		r.Succeeded++
+	}
+	r.Outcomes = append(r.Outcomes, BulkOutcome{Index: index, ID: id, Status: status, Message: message})
+}
+
+// bulkUpsertRecord is a consent carrying the idempotency key of the import record it came from.
+type bulkUpsertRecord struct {
+	IdempotencyKey string `json:"idempotencyKey"`
+	consentInput
+}
+
+// BulkUpsertConsents creates or overwrites the consents in a JSON array. Every record must carry an
+// idempotencyKey; records whose key has already been applied, by this or an earlier call, are skipped
+// rather than failed, so an interrupted import can simply be resubmitted. Records may only carry
+// the fields CreateConsent takes. A new consent is validated like CreateConsent; an existing one is
+// updated like UpdateConsent, taking only the fields UpdateConsent takes from the record. Overwriting
+// an existing consent requires membership of the organization that created it and admin rights
+// over its provider. A record for a consent an earlier record of the same call wrote is failed.
+func (s *SmartContract) BulkUpsertConsents(ctx contractapi.TransactionContextInterface, consentsJSON string) (*BulkResult, error) {
+	var records []bulkUpsertRecord
+	err := decodeStrict(consentsJSON, &records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse consents: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newBulkResult()
+	// writes are not visible to reads in the same transaction, so track the keys applied and the
+	// consents written by this batch
+	seen := make(map[string]bool)
+	written := make(map[string]bool)
+	for i := range records {
+		record := &records[i]
+		if record.IdempotencyKey == "" {
+			result.record(i, record.ID, outcomeFailed, "missing idempotencyKey")
+			continue
+		}
+		if record.ID == "" {
+			result.record(i, record.ID, outcomeFailed, "missing id")
+			continue
+		}
+		if seen[record.IdempotencyKey] {
+			result.record(i, record.ID, outcomeSkipped, "idempotencyKey repeated in batch")
+			continue
+		}
+
+		idempotencyKey, err := ctx.GetStub().CreateCompositeKey(idempotencyKeyObjectType, []string{record.IdempotencyKey})
+		if err != nil {
+			return nil, err
+		}
+		applied, err := ctx.GetStub().GetState(idempotencyKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if applied != nil {
+			result.record(i, record.ID, outcomeSkipped, fmt.Sprintf("already applied to consent %s", applied))
+			continue
+		}
+		if written[record.ID] {
+			result.record(i, record.ID, outcomeFailed, "consent id repeated in batch")
+			continue
+		}
+
+		existingJSON, err := ctx.GetStub().GetState(record.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		exists := existingJSON != nil
+		var consent *Consent
+		if exists {
+			var existing Consent
+			err = json.Unmarshal(existingJSON, &existing)
+			if err != nil {
+				return nil, err
+			}
+			consent, err = upsertedConsent(ctx, &existing, &record.consentInput, now)
+		} else {
+			consent, err = s.newConsent(ctx, &record.consentInput)
+		}
+		if err != nil {
+			result.record(i, record.ID, outcomeFailed, err.Error())
+			continue
+		}
+
+		err = putConsent(ctx, consent)
+		if err != nil {
+			return nil, err
+		}
+		err = ctx.GetStub().PutState(idempotencyKey, []byte(record.ID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to put to world state. %v", err)
+		}
+		seen[record.IdempotencyKey] = true
+		written[record.ID] = true
+
+		if exists {
+			result.record(i, record.ID, outcomeUpdated, "")
+		} else {
+			result.record(i, record.ID, outcomeCreated, "")
+		}
+	}
+
+	return result, nil
+}
+
+// upsertedConsent applies the fields of a BulkUpsertConsents record that UpdateConsent takes to
+// the existing consent, after the same checks as UpdateConsent, and returns the updated copy.
+func upsertedConsent(ctx contractapi.TransactionContextInterface, existing *Consent, input *consentInput, now time.Time) (*Consent, error) {
+	provider, err := normalizeProvider(input.Provider)
+	if err != nil {
+		return nil, err
+	}
+	err = assertOwnerMSP(ctx, existing)
+	if err != nil {
+		return nil, err
+	}
+	err = assertProviderAdmin(ctx, existing.Provider)
+	if err != nil {
+		return nil, err
+	}
+	err = assertNotFrozen(existing)
+	if err != nil {
+		return nil, err
+	}
+	if provider != existing.Provider {
+		err = assertProviderAdmin(ctx, provider)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if input.Service != existing.Service || provider != existing.Provider {
+		err = validateServiceForProvider(ctx, input.Service, provider)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	consent := *existing
+	consent.PreviousValues = changedFields(existing, map[string]string{
+		"userId":         input.UserID,
+		"service":        input.Service,
+		"provider":       provider,
+		"consentGiven":   strconv.FormatBool(input.ConsentGiven),
+		"timestamp":      input.Timestamp,
+		"expirationDate": input.ExpirationDate,
+		"purpose":        input.Purpose,
+	})
+	consent.UserID = input.UserID
+	consent.Service = input.Service
+	consent.Provider = provider
+	consent.ConsentGiven = input.ConsentGiven
+	consent.Timestamp = input.Timestamp
+	consent.ExpirationDate = input.ExpirationDate
+	consent.Purpose = input.Purpose
+	if input.ConsentGiven {
+		consent.OptedOut = false
+	}
+
+	err = validateConsentDates(&consent)
+	if err != nil {
+		return nil, err
+	}
+	err = assertTransition(existing, consentStatus(&consent, now), now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+// CreateConsentsBulk creates every consent in a JSON array in a single transaction and returns how
+// many were written. Records may only carry the fields CreateConsent takes, each record is
+// validated like a CreateConsent call, and IDs must be unique both on the ledger and within the
+// batch. The batch is all-or-nothing: the first invalid record fails the whole call with an error
+// naming its index, and nothing is written.
+func (s *SmartContract) CreateConsentsBulk(ctx contractapi.TransactionContextInterface, consentsJSON string) (int, error) {
+	var inputs []consentInput
+	err := decodeStrict(consentsJSON, &inputs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse consents: %v", err)
+	}
+
+	// writes are not visible to reads in the same transaction, so track IDs created by this batch
+	created := make(map[string]bool)
+	consents := make([]*Consent, 0, len(inputs))
+	for i := range inputs {
+		input := &inputs[i]
+		if input.ID == "" {
+			return 0, fmt.Errorf("consent at index %d: the consent id must not be empty", i)
+		}
+		if created[input.ID] {
+			return 0, fmt.Errorf("consent at index %d: the consent %s is repeated in the batch", i, input.ID)
+		}
+		exists, err := s.ConsentExists(ctx, input.ID)
+		if err != nil {
+			return 0, err
+		}
+		if exists {
+			return 0, fmt.Errorf("consent at index %d: the consent %s already exists", i, input.ID)
+		}
+		consent, err := s.newConsent(ctx, input)
+		if err != nil {
+			return 0, fmt.Errorf("consent at index %d: %v", i, err)
+		}
+		created[input.ID] = true
+		consents = append(consents, consent)
+	}
+
+	for _, consent := range consents {
+		err = putConsent(ctx, consent)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(consents), nil
+}
+
+// queryDeletion is the payload of the ConsentsDeletedByQuery event.
+type queryDeletion struct {
+	Selector   json.RawMessage `json:"selector"`
+	DeletedIDs []string        `json:"deletedIds"`
+}
+
+// DeleteConsentsByQuery deletes every consent matching the CouchDB selector of a query such as
+// {"selector":{"provider":"JIO","purpose":"marketing"}}, reporting an outcome per matching ID. Only
+// the selector is used; a missing or empty selector is rejected so that a mistake cannot wipe the
+// whole ledger. Only live consents are matched, never archived ones. Consents under legal hold or
+// owned by another organization fail individually. A single ConsentsDeletedByQuery event lists the
+// deleted IDs. Only admins may delete by query.
+func (s *SmartContract) DeleteConsentsByQuery(ctx contractapi.TransactionContextInterface, queryJSON string) (*BulkResult, error) {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var query struct {
+		Selector map[string]json.RawMessage `json:"selector"`
+	}
+	err = json.Unmarshal([]byte(queryJSON), &query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %v", err)
+	}
+	if len(query.Selector) == 0 {
+		return nil, fmt.Errorf("the query must have a non-empty selector")
+	}
+	selector, err := json.Marshal(query.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(fmt.Sprintf(`{"selector":%s}`, selector))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	result := newBulkResult()
+	deletion := queryDeletion{Selector: selector, DeletedIDs: []string{}}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		// the selector also matches indexes, settings, audit records and archived consents
+		consent, err := decodeQueryResult(queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		if consent == nil {
+			continue
+		}
+		// number outcomes by position among the matched consents, not among all query results
+		i := len(result.Outcomes)
+		err = assertOwnerMSP(ctx, consent)
+		if err != nil {
+			result.record(i, consent.ID, outcomeFailed, err.Error())
+			continue
+		}
+		err = assertNotFrozen(consent)
+		if err != nil {
+			result.record(i, consent.ID, outcomeFailed, err.Error())
+			continue
+		}
+
+		err = deleteConsent(ctx, consent)
+		if err != nil {
+			return nil, err
+		}
+		deletion.DeletedIDs = append(deletion.DeletedIDs, consent.ID)
+		result.record(i, consent.ID, outcomeDeleted, "")
+	}
+
+	err = emitEvent(ctx, "ConsentsDeletedByQuery", deletion)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// bulkExtension is the payload of the ConsentsExtended event.
+type bulkExtension struct {
+	Duration    string   `json:"duration"`
+	ExtendedIDs []string `json:"extendedIds"`
+}
+
+// BulkExtendConsents applies ExtendConsent to every ID in a JSON array, reporting a per-record
+// outcome instead of failing the whole batch; missing and revoked consents are skipped with the
+// reason, and consents past the soft-expire window fail. The duration is validated once up front.
+// A single ConsentsExtended event lists the IDs that were extended. The caller must be an admin for
+// the provider of each consent extended.
+func (s *SmartContract) BulkExtendConsents(ctx contractapi.TransactionContextInterface, idsJSON string, duration string) (*BulkResult, error) {
+	d, err := parseExtension(duration)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	err = json.Unmarshal([]byte(idsJSON), &ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ids: %v", err)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	windowDays, err := s.GetSoftExpireWindowDays(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newBulkResult()
+	extension := bulkExtension{Duration: duration, ExtendedIDs: []string{}}
+	extended := make(map[string]bool)
+	for i, id := range ids {
+		if extended[id] {
+			result.record(i, id, outcomeSkipped, "id repeated in batch")
+			continue
+		}
+		consentJSON, err := ctx.GetStub().GetState(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if consentJSON == nil {
+			result.record(i, id, outcomeSkipped, "does not exist")
+			continue
+		}
+		var consent Consent
+		err = json.Unmarshal(consentJSON, &consent)
+		if err != nil {
+			return nil, err
+		}
+		if !consent.ConsentGiven {
+			result.record(i, id, outcomeSkipped, "revoked")
+			continue
+		}
+		err = assertProviderAdmin(ctx, consent.Provider)
+		if err != nil {
+			result.record(i, id, outcomeFailed, err.Error())
+			continue
+		}
+		err = assertNotFrozen(&consent)
+		if err != nil {
+			result.record(i, id, outcomeFailed, err.Error())
+			continue
+		}
+
+		previousExpiration := consent.ExpirationDate
+		err = extendConsent(&consent, d, now, windowDays)
+		if err != nil {
+			result.record(i, id, outcomeFailed, err.Error())
+			continue
+		}
+		err = applyRegionExpiryCap(ctx, &consent, now)
+		if err != nil {
+			result.record(i, id, outcomeFailed, err.Error())
+			continue
+		}
+		err = putConsent(ctx, &consent)
+		if err != nil {
+			return nil, err
+		}
+		err = putExpiryChange(ctx, id, previousExpiration, consent.ExpirationDate)
+		if err != nil {
+			return nil, err
+		}
+		extended[id] = true
+		extension.ExtendedIDs = append(extension.ExtendedIDs, id)
+		result.record(i, id, outcomeUpdated, "")
+	}
+
+	err = emitEvent(ctx, "ConsentsExtended", extension)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// bulkReassignment is the payload of the ConsentsReassigned event.
+type bulkReassignment struct {
+	Users    int `json:"users"`
+	Consents int `json:"consents"`
+}
+
+// ReassignConsentsBulk moves every consent of each old user ID in a JSON object of
+// oldUserId->newUserId to the new user ID, e.g. after accounts have been merged. Users are processed
+// in sorted order and each gets an outcome: skipped when they hold no consents, failed when the new
+// user ID is empty or one of their consents is under legal hold. Consents are rewritten through
+// putConsent, which keeps the secondary indexes in step. A single ConsentsReassigned event
+// summarises the batch. Only admins may reassign consents.
+func (s *SmartContract) ReassignConsentsBulk(ctx contractapi.TransactionContextInterface, mappingJSON string) (*BulkResult, error) {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var mapping map[string]string
+	err = json.Unmarshal([]byte(mappingJSON), &mapping)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mapping: %v", err)
+	}
+
+	oldUserIds := make([]string, 0, len(mapping))
+	for oldUserId := range mapping {
+		oldUserIds = append(oldUserIds, oldUserId)
+	}
+	sort.Strings(oldUserIds)
+
+	result := newBulkResult()
+	summary := bulkReassignment{}
+	for i, oldUserId := range oldUserIds {
+		newUserId := strings.TrimSpace(mapping[oldUserId])
+		if newUserId == "" {
+			result.record(i, oldUserId, outcomeFailed, "new user id must not be empty")
+			continue
+		}
+		if newUserId == oldUserId {
+			result.record(i, oldUserId, outcomeSkipped, "new user id is unchanged")
+			continue
+		}
+		consents, err := s.GetConsentsByUser(ctx, oldUserId)
+		if err != nil {
+			return nil, err
+		}
+		if len(consents) == 0 {
+			result.record(i, oldUserId, outcomeSkipped, "no consents")
+			continue
+		}
+		err = assertNoneFrozen(consents)
+		if err != nil {
+			result.record(i, oldUserId, outcomeFailed, err.Error())
+			continue
+		}
+
+		for _, consent := range consents {
+			consent.UserID = newUserId
+			err = putConsent(ctx, consent)
+			if err != nil {
+				return nil, err
+			}
+		}
+		summary.Users++
+		summary.Consents += len(consents)
+		result.record(i, oldUserId, outcomeUpdated, fmt.Sprintf("reassigned %d consents to %s", len(consents), newUserId))
+	}
+
+	err = emitEvent(ctx, "ConsentsReassigned", summary)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// userDataErased is the payload of the UserDataErased event.
+type userDataErased struct {
+	UserID string `json:"userId"`
+	Count  int    `json:"count"`
+}
+
+// DeleteAllConsentsForUser erases every consent of the given user in a single transaction, for a
+// data subject's right to be forgotten, archived copies included, and returns how many records were
+// deleted; a user without consents yields 0. The whole erasure fails if any of the live consents is
+// under legal hold or owned by another organization. A UserDataErased event records the user and
+// count. Only the user themselves or an admin may erase their consents. Earlier versions remain in
+// the ledger's history, and consents created by CreateConsentPrivate carry no public userId so are
+// not found.
+func (s *SmartContract) DeleteAllConsentsForUser(ctx contractapi.TransactionContextInterface, userId string) (int, error) {
+	if userId == "" {
+		return 0, fmt.Errorf("the user id must not be empty")
+	}
+	err := assertUserOrAdmin(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	consents, err := s.GetConsentsByUser(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	err = assertNoneFrozen(consents)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, consent := range consents {
+		err = assertOwnerMSP(ctx, consent)
+		if err != nil {
+			return 0, err
+		}
+		err = deleteConsent(ctx, consent)
+		if err != nil {
+			return 0, err
+		}
+	}
+	archived, err := deleteArchivedConsentsForUser(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	count := len(consents) + archived
+
+	err = emitEvent(ctx, "UserDataErased", userDataErased{UserID: userId, Count: count})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// assertNoneFrozen returns the legal-hold error of the first frozen consent, if any.
+func assertNoneFrozen(consents []*Consent) error {
+	for _, consent := range consents {
+		err := assertNotFrozen(consent)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// csvHeader is the header row ImportConsentsCSV expects, in this order.
+var csvHeader = []string{"id", "userId", "service", "provider", "consentGiven", "timestamp", "expirationDate", "purpose", "collectionMethod", "termsVersion"}
+
+// ImportConsentsCSV creates a consent for every data row of a CSV document whose first row is
+// exactly csvHeader. Fields may be quoted per RFC 4180. A malformed header or document rejects the
+// whole import; otherwise each row is validated like a CreateConsent call, duplicate check
+// included, and reported individually, with row indexes counted from the first data row. Only the
+// columns of csvHeader are read, so no system field can be set on import.
+func (s *SmartContract) ImportConsentsCSV(ctx contractapi.TransactionContextInterface, csvData string) (*BulkResult, error) {
+	reader := csv.NewReader(strings.NewReader(csvData))
+	reader.FieldsPerRecord = len(csvHeader)
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("the CSV has no header row")
+	}
+	for i, column := range rows[0] {
+		if strings.TrimSpace(column) != csvHeader[i] {
+			return nil, fmt.Errorf("malformed CSV header: column %d is %q, expected %q", i+1, column, csvHeader[i])
+		}
+	}
+
+	result := newBulkResult()
+	created := make(map[string]bool)
+	for i, row := range rows[1:] {
+		consentGiven, err := strconv.ParseBool(row[4])
+		if err != nil {
+			result.record(i, row[0], outcomeFailed, fmt.Sprintf("invalid consentGiven %q", row[4]))
+			continue
+		}
+		input := consentInput{
+			ID:               row[0],
+			UserID:           row[1],
+			Service:          row[2],
+			Provider:         row[3],
+			ConsentGiven:     consentGiven,
+			Timestamp:        row[5],
+			ExpirationDate:   row[6],
+			Purpose:          row[7],
+			CollectionMethod: row[8],
+			TermsVersion:     row[9],
+		}
+		if input.ID == "" {
+			result.record(i, input.ID, outcomeFailed, "missing id")
+			continue
+		}
+
+		exists, err := s.ConsentExists(ctx, input.ID)
+		if err != nil {
+			return nil, err
+		}
+		if exists || created[input.ID] {
+			result.record(i, input.ID, outcomeFailed, fmt.Sprintf("the consent %s already exists", input.ID))
+			continue
+		}
+		consent, err := s.newConsent(ctx, &input)
+		if err != nil {
+			result.record(i, input.ID, outcomeFailed, err.Error())
+			continue
+		}
+
+		err = putConsent(ctx, consent)
+		if err != nil {
+			return nil, err
+		}
+		created[consent.ID] = true
+		result.record(i, consent.ID, outcomeCreated, "")
+	}
+
+	return result, nil
+}
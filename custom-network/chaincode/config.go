@@ -0,0 +1,552 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// configObjectType is the composite key namespace for admin-managed policy settings.
+const configObjectType = "config"
+
+// Policy setting names and their defaults when an admin has not configured them.
+const (
+	softExpireWindowConfig      = "softExpireWindowDays"
+	defaultSoftExpireWindowDays = 30
+	retentionDaysConfig         = "retentionDays"
+	defaultRetentionDays        = 365
+	purposeLabelsConfig         = "purposeLabels"
+	collectionMethodsConfig     = "collectionMethods"
+	termsVersionsConfig         = "activeTermsVersions"
+	retentionCategoriesConfig   = "retentionCategories"
+	reminderLeadDaysConfig      = "reminderLeadDays"
+	serviceProviderMatrixConfig = "serviceProviderMatrix"
+	ageRestrictedServicesConfig = "ageRestrictedServices"
+	regionExpiryPoliciesConfig  = "regionExpiryPolicies"
+	reviewIntervalsConfig       = "reviewIntervalDays"
+	defaultExpiryDaysConfig     = "defaultExpiryDays"
+	providerExpiryDaysConfig    = "providerDefaultExpiryDays"
+)
+
+// defaultCollectionMethods are the consent collection channels allowed until an admin sets the list.
+var defaultCollectionMethods = []string{"web", "ivr", "paper"}
+
+// defaultTermsVersions are the active terms versions until an admin sets the list.
+var defaultTermsVersions = []string{"privacy-policy-v1"}
+
+// defaultRetentionCategories are the allowed retention categories until an admin sets the list.
+var defaultRetentionCategories = []string{"short", "standard", "long"}
+
+// defaultServiceProviderMatrix lists the services each provider offers until an admin sets them.
+var defaultServiceProviderMatrix = map[string][]string{
+	"JIO":    {"data-sharing", "profile-access"},
+	"Airtel": {"data-sharing", "profile-access"},
+}
+
+// getConfig reads the named setting into v and reports whether it has been set.
+func getConfig(ctx contractapi.TransactionContextInterface, name string, v interface{}) (bool, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(configObjectType, []string{name})
+	if err != nil {
+		return false, err
+	}
+	valueJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if valueJSON == nil {
+		return false, nil
+	}
+
+	err = json.Unmarshal(valueJSON, v)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse setting %s: %v", name, err)
+	}
+
+	return true, nil
+}
+
+// putConfig stores the named setting.
+func putConfig(ctx contractapi.TransactionContextInterface, name string, v interface{}) error {
+	key, err := ctx.GetStub().CreateCompositeKey(configObjectType, []string{name})
+	if err != nil {
+		return err
+	}
+	valueJSON, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, valueJSON)
+}
+
+// getConfigList reads a list setting, returning defaults when it has not been set.
+func getConfigList(ctx contractapi.TransactionContextInterface, name string, defaults []string) ([]string, error) {
+	var values []string
+	found, err := getConfig(ctx, name, &values)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return defaults, nil
+	}
+
+	return values, nil
+}
+
+// putConfigList stores a non-empty list setting without blank entries.
+func putConfigList(ctx contractapi.TransactionContextInterface, name string, values []string) error {
+	if len(values) == 0 {
+		return fmt.Errorf("%s must not be empty", name)
+	}
+	for _, value := range values {
+		if value == "" {
+			return fmt.Errorf("%s must not contain empty values", name)
+		}
+	}
+
+	return putConfig(ctx, name, values)
+}
+
+// contains returns true when value is one of values.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetSoftExpireWindowDays sets how many days after expiry a consent may still be reactivated.
+func (s *SmartContract) SetSoftExpireWindowDays(ctx contractapi.TransactionContextInterface, days int) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if days < 0 {
+		return fmt.Errorf("softExpireWindowDays must not be negative, got %d", days)
+	}
+
+	return putConfig(ctx, softExpireWindowConfig, days)
+}
+
+// GetSoftExpireWindowDays returns the reactivation window in days.
+func (s *SmartContract) GetSoftExpireWindowDays(ctx contractapi.TransactionContextInterface) (int, error) {
+	days := defaultSoftExpireWindowDays
+	_, err := getConfig(ctx, softExpireWindowConfig, &days)
+	if err != nil {
+		return 0, err
+	}
+
+	return days, nil
+}
+
+// SetRetentionDays sets how many days archived consents are kept before they may be purged.
+func (s *SmartContract) SetRetentionDays(ctx contractapi.TransactionContextInterface, days int) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if days < 0 {
+		return fmt.Errorf("retentionDays must not be negative, got %d", days)
+	}
+
+	return putConfig(ctx, retentionDaysConfig, days)
+}
+
+// GetRetentionDays returns the archive retention period in days.
+func (s *SmartContract) GetRetentionDays(ctx contractapi.TransactionContextInterface) (int, error) {
+	days := defaultRetentionDays
+	_, err := getConfig(ctx, retentionDaysConfig, &days)
+	if err != nil {
+		return 0, err
+	}
+
+	return days, nil
+}
+
+// SetPurposeLabel sets the display label of a purpose for a locale. An empty label removes it.
+func (s *SmartContract) SetPurposeLabel(ctx contractapi.TransactionContextInterface, purpose string, locale string, label string) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if purpose == "" || locale == "" {
+		return fmt.Errorf("purpose and locale must not be empty")
+	}
+
+	labels, err := s.GetPurposeLabels(ctx)
+	if err != nil {
+		return err
+	}
+	if label == "" {
+		delete(labels[purpose], locale)
+		if len(labels[purpose]) == 0 {
+			delete(labels, purpose)
+		}
+	} else {
+		if labels[purpose] == nil {
+			labels[purpose] = make(map[string]string)
+		}
+		labels[purpose][locale] = label
+	}
+
+	return putConfig(ctx, purposeLabelsConfig, labels)
+}
+
+// GetPurposeLabels returns the configured purpose labels keyed by purpose and then locale.
+func (s *SmartContract) GetPurposeLabels(ctx contractapi.TransactionContextInterface) (map[string]map[string]string, error) {
+	labels := make(map[string]map[string]string)
+	_, err := getConfig(ctx, purposeLabelsConfig, &labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// SetAllowedCollectionMethods replaces the list of channels consents may be collected through.
+func (s *SmartContract) SetAllowedCollectionMethods(ctx contractapi.TransactionContextInterface, methods []string) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putConfigList(ctx, collectionMethodsConfig, methods)
+}
+
+// GetAllowedCollectionMethods returns the channels consents may be collected through.
+func (s *SmartContract) GetAllowedCollectionMethods(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	return getConfigList(ctx, collectionMethodsConfig, defaultCollectionMethods)
+}
+
+// SetActiveTermsVersions replaces the list of terms versions new consents may be given under.
+// Deprecating a version only affects new consents; use GetConsentsByTermsVersion to find the
+// existing consents that need to be solicited again.
+func (s *SmartContract) SetActiveTermsVersions(ctx contractapi.TransactionContextInterface, versions []string) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putConfigList(ctx, termsVersionsConfig, versions)
+}
+
+// GetActiveTermsVersions returns the terms versions new consents may be given under.
+func (s *SmartContract) GetActiveTermsVersions(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	return getConfigList(ctx, termsVersionsConfig, defaultTermsVersions)
+}
+
+// SetAllowedRetentionCategories replaces the list of retention categories consents may be assigned.
+func (s *SmartContract) SetAllowedRetentionCategories(ctx contractapi.TransactionContextInterface, categories []string) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putConfigList(ctx, retentionCategoriesConfig, categories)
+}
+
+// GetAllowedRetentionCategories returns the retention categories consents may be assigned.
+func (s *SmartContract) GetAllowedRetentionCategories(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	return getConfigList(ctx, retentionCategoriesConfig, defaultRetentionCategories)
+}
+
+// SetReminderLeadDays sets how many days before expiry consents of the given provider become due
+// for a reminder, overriding the threshold passed by the caller of the reminder queries.
+func (s *SmartContract) SetReminderLeadDays(ctx contractapi.TransactionContextInterface, provider string, days int) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	provider, err = normalizeProvider(provider)
+	if err != nil {
+		return err
+	}
+	if days < 0 {
+		return fmt.Errorf("reminderLeadDays must not be negative, got %d", days)
+	}
+
+	leadDays, err := s.GetReminderLeadDays(ctx)
+	if err != nil {
+		return err
+	}
+	leadDays[provider] = days
+
+	return putConfig(ctx, reminderLeadDaysConfig, leadDays)
+}
+
+// ClearReminderLeadDays removes the provider's reminder lead time, so the caller's threshold applies again.
+func (s *SmartContract) ClearReminderLeadDays(ctx contractapi.TransactionContextInterface, provider string) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	leadDays, err := s.GetReminderLeadDays(ctx)
+	if err != nil {
+		return err
+	}
+	delete(leadDays, provider)
+
+	return putConfig(ctx, reminderLeadDaysConfig, leadDays)
+}
+
+// GetReminderLeadDays returns the configured reminder lead times in days keyed by provider.
+func (s *SmartContract) GetReminderLeadDays(ctx contractapi.TransactionContextInterface) (map[string]int, error) {
+	leadDays := make(map[string]int)
+	_, err := getConfig(ctx, reminderLeadDaysConfig, &leadDays)
+	if err != nil {
+		return nil, err
+	}
+
+	return leadDays, nil
+}
+
+// SetDefaultExpiryDays sets how many days after the transaction time new consents expire when they
+// are created without an expiration date and their provider has no default of its own. Zero
+// removes the default, making the expiration date required again.
+func (s *SmartContract) SetDefaultExpiryDays(ctx contractapi.TransactionContextInterface, days int) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if days < 0 {
+		return fmt.Errorf("defaultExpiryDays must not be negative, got %d", days)
+	}
+
+	return putConfig(ctx, defaultExpiryDaysConfig, days)
+}
+
+// GetDefaultExpiryDays returns the global default consent lifetime in days, 0 when there is none.
+func (s *SmartContract) GetDefaultExpiryDays(ctx contractapi.TransactionContextInterface) (int, error) {
+	days := 0
+	_, err := getConfig(ctx, defaultExpiryDaysConfig, &days)
+	if err != nil {
+		return 0, err
+	}
+
+	return days, nil
+}
+
+// SetProviderDefaultExpiryDays sets the default consent lifetime in days for one provider, taking
+// precedence over the global default. Zero removes the provider's default.
+func (s *SmartContract) SetProviderDefaultExpiryDays(ctx contractapi.TransactionContextInterface, provider string, days int) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	provider, err = normalizeProvider(provider)
+	if err != nil {
+		return err
+	}
+	if days < 0 {
+		return fmt.Errorf("defaultExpiryDays must not be negative, got %d", days)
+	}
+
+	defaults, err := s.GetProviderDefaultExpiryDays(ctx)
+	if err != nil {
+		return err
+	}
+	if days == 0 {
+		delete(defaults, provider)
+	} else {
+		defaults[provider] = days
+	}
+
+	return putConfig(ctx, providerExpiryDaysConfig, defaults)
+}
+
+// GetProviderDefaultExpiryDays returns the provider-specific default consent lifetimes in days.
+func (s *SmartContract) GetProviderDefaultExpiryDays(ctx contractapi.TransactionContextInterface) (map[string]int, error) {
+	defaults := make(map[string]int)
+	_, err := getConfig(ctx, providerExpiryDaysConfig, &defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	return defaults, nil
+}
+
+// SetServicesForProvider replaces the list of services the provider offers.
+func (s *SmartContract) SetServicesForProvider(ctx contractapi.TransactionContextInterface, provider string, services []string) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	provider, err = normalizeProvider(provider)
+	if err != nil {
+		return err
+	}
+	if len(services) == 0 {
+		return fmt.Errorf("services must not be empty")
+	}
+	for _, service := range services {
+		if service == "" {
+			return fmt.Errorf("services must not contain empty values")
+		}
+	}
+
+	matrix, err := getServiceProviderMatrix(ctx)
+	if err != nil {
+		return err
+	}
+	matrix[provider] = services
+
+	return putConfig(ctx, serviceProviderMatrixConfig, matrix)
+}
+
+// GetServicesForProvider returns the services the provider offers.
+func (s *SmartContract) GetServicesForProvider(ctx contractapi.TransactionContextInterface, provider string) ([]string, error) {
+	matrix, err := getServiceProviderMatrix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	services, ok := matrix[provider]
+	if !ok {
+		return nil, fmt.Errorf("no services are configured for provider %s", provider)
+	}
+
+	return services, nil
+}
+
+// getServiceProviderMatrix reads the services offered keyed by provider, returning the defaults
+// when it has not been set.
+func getServiceProviderMatrix(ctx contractapi.TransactionContextInterface) (map[string][]string, error) {
+	matrix := make(map[string][]string)
+	found, err := getConfig(ctx, serviceProviderMatrixConfig, &matrix)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		for provider, services := range defaultServiceProviderMatrix {
+			matrix[provider] = services
+		}
+	}
+
+	return matrix, nil
+}
+
+// SetAgeRestrictedServices replaces the list of services that require the user's age to have been
+// verified. An empty list lifts the restriction from every service.
+func (s *SmartContract) SetAgeRestrictedServices(ctx contractapi.TransactionContextInterface, services []string) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		if service == "" {
+			return fmt.Errorf("%s must not contain empty values", ageRestrictedServicesConfig)
+		}
+	}
+	if services == nil {
+		services = []string{}
+	}
+
+	return putConfig(ctx, ageRestrictedServicesConfig, services)
+}
+
+// GetAgeRestrictedServices returns the services that require the user's age to have been verified.
+func (s *SmartContract) GetAgeRestrictedServices(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	return getConfigList(ctx, ageRestrictedServicesConfig, []string{})
+}
+
+// RegionExpiryPolicy caps how long consents of a region may be valid for. Expirations beyond the cap
+// are clamped to it when Clamp is set and rejected otherwise
+type RegionExpiryPolicy struct {
+	Region  string `json:"region"`
+	MaxDays int    `json:"maxDays"`
+	Clamp   bool   `json:"clamp"`
+}
+
+// SetRegionExpiryPolicy sets the maximum validity in days of consents in a region and whether longer
+// expirations are clamped or rejected. Zero maxDays removes the region's cap.
+func (s *SmartContract) SetRegionExpiryPolicy(ctx contractapi.TransactionContextInterface, region string, maxDays int, clamp bool) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if region == "" {
+		return fmt.Errorf("region must not be empty")
+	}
+	if maxDays < 0 {
+		return fmt.Errorf("maxDays must not be negative, got %d", maxDays)
+	}
+
+	policies, err := getRegionExpiryPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	if maxDays == 0 {
+		delete(policies, region)
+	} else {
+		policies[region] = RegionExpiryPolicy{Region: region, MaxDays: maxDays, Clamp: clamp}
+	}
+
+	return putConfig(ctx, regionExpiryPoliciesConfig, policies)
+}
+
+// GetRegionExpiryPolicy returns the expiry policy of a region.
+func (s *SmartContract) GetRegionExpiryPolicy(ctx contractapi.TransactionContextInterface, region string) (*RegionExpiryPolicy, error) {
+	policies, err := getRegionExpiryPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy, ok := policies[region]
+	if !ok {
+		return nil, fmt.Errorf("no expiry policy is configured for region %s", region)
+	}
+
+	return &policy, nil
+}
+
+// getRegionExpiryPolicies reads the expiry policies keyed by region.
+func getRegionExpiryPolicies(ctx contractapi.TransactionContextInterface) (map[string]RegionExpiryPolicy, error) {
+	policies := make(map[string]RegionExpiryPolicy)
+	_, err := getConfig(ctx, regionExpiryPoliciesConfig, &policies)
+	if err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// SetReviewIntervalDays sets how many days after creation consents for a purpose are due for
+// governance review. Zero removes the purpose's review interval.
+func (s *SmartContract) SetReviewIntervalDays(ctx contractapi.TransactionContextInterface, purpose string, days int) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if purpose == "" {
+		return fmt.Errorf("purpose must not be empty")
+	}
+	if days < 0 {
+		return fmt.Errorf("reviewIntervalDays must not be negative, got %d", days)
+	}
+
+	intervals, err := s.GetReviewIntervalDays(ctx)
+	if err != nil {
+		return err
+	}
+	if days == 0 {
+		delete(intervals, purpose)
+	} else {
+		intervals[purpose] = days
+	}
+
+	return putConfig(ctx, reviewIntervalsConfig, intervals)
+}
+
+// GetReviewIntervalDays returns the configured review intervals in days keyed by purpose.
+func (s *SmartContract) GetReviewIntervalDays(ctx contractapi.TransactionContextInterface) (map[string]int, error) {
+	intervals := make(map[string]int)
+	_, err := getConfig(ctx, reviewIntervalsConfig, &intervals)
+	if err != nil {
+		return nil, err
+	}
+
+	return intervals, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Consent dates are stored either as RFC3339 timestamps or as date-only values in the
+// dateOnlyLayout format, which are interpreted in UTC.
+const dateOnlyLayout = "2006-01-02"
+
+// parseConsentDate parses a stored or supplied consent date, naming the field in any error.
+func parseConsentDate(field string, value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(dateOnlyLayout, value); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid %s %q: expected RFC3339 or %s", field, value, dateOnlyLayout)
+}
+
+// normalizeConsentDate rewrites an RFC3339 value in UTC with whole seconds, so that stored dates
+// compare correctly as strings: same-format values sort chronologically, and a date-only value sorts
+// before every time on that day. Date-only and unparseable values are returned unchanged.
+func normalizeConsentDate(value string) string {
+	if isDateOnly(value) {
+		return value
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// isDateOnly returns true when value is a date without a time-of-day component.
+func isDateOnly(value string) bool {
+	_, err := time.Parse(dateOnlyLayout, value)
+	return err == nil
+}
+
+// NormalizeExpirationTimes rewrites every date-only ExpirationDate as an explicit RFC3339 UTC time,
+// either at the start (00:00:00) or the end (23:59:59) of that day, and returns the number of
+// consents changed. Values that already carry a time are left untouched.
+func (s *SmartContract) NormalizeExpirationTimes(ctx contractapi.TransactionContextInterface, endOfDay bool) (int, error) {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		if !isDateOnly(consent.ExpirationDate) || consent.Frozen {
+			return nil
+		}
+
+		day, err := time.Parse(dateOnlyLayout, consent.ExpirationDate)
+		if err != nil {
+			return err
+		}
+		if endOfDay {
+			day = day.Add(24*time.Hour - time.Second)
+		}
+
+		consent.ExpirationDate = day.UTC().Format(time.RFC3339)
+		changed++
+		return putConsent(ctx, consent)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return changed, nil
+}
+
+// txTime returns the transaction timestamp, which is identical on every endorser.
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	return timestamp.AsTime(), nil
+}
+
+// daysUntil returns the number of whole days from now until t, negative when t is in the past.
+func daysUntil(t time.Time, now time.Time) int {
+	return int(math.Floor(t.Sub(now).Hours() / 24))
+}
+
+// parseDateRange parses an inclusive [startDate, endDate] range. A date-only endDate is extended
+// to the last instant of that day so that the whole day is covered.
+func parseDateRange(startDate string, endDate string) (time.Time, time.Time, error) {
+	start, err := parseConsentDate("startDate", startDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parseConsentDate("endDate", endDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if isDateOnly(endDate) {
+		end = end.Add(24*time.Hour - time.Nanosecond)
+	}
+	if start.After(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("startDate %s is after endDate %s", startDate, endDate)
+	}
+
+	return start, end, nil
+}
+
+// parseExtension parses a positive duration given either in days ("30d") or in Go duration
+// syntax ("720h").
+func parseExtension(duration string) (time.Duration, error) {
+	var d time.Duration
+	if strings.HasSuffix(duration, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(duration, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %v", duration, err)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(duration)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %v", duration, err)
+		}
+		d = parsed
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q: must be positive", duration)
+	}
+
+	return d, nil
+}
+
+// addToConsentDate adds d to a stored date, keeping the date-only format when d is a whole
+// number of days.
+func addToConsentDate(field string, value string, d time.Duration) (string, error) {
+	t, err := parseConsentDate(field, value)
+	if err != nil {
+		return "", err
+	}
+	if isDateOnly(value) && d%(24*time.Hour) == 0 {
+		return t.Add(d).Format(dateOnlyLayout), nil
+	}
+
+	return t.Add(d).UTC().Format(time.RFC3339), nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConsentDate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2024-03-01T12:00:00Z", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), false},
+		{"2024-03-01T17:30:00+05:30", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), false},
+		{"2024-03-01", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), false},
+		{"", time.Time{}, true},
+		{"01/03/2024", time.Time{}, true},
+		{"2024-02-30", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseConsentDate("expirationDate", tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseConsentDate(%q) succeeded, want an error", tt.value)
+				}
+				if !strings.Contains(err.Error(), "expirationDate") || !strings.Contains(err.Error(), tt.value) {
+					t.Errorf("error %q does not name the field and value", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseConsentDate(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
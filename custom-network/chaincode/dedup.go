@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// dedupKey returns the key shared by all consents of a user for the same service and provider. It is
+// empty for consents with no public UserID, such as those created by CreateConsentPrivate, whose
+// key would otherwise both group unrelated users and link a user's private consents.
+func dedupKey(consent *Consent) string {
+	if consent.UserID == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(consent.UserID + "\x00" + consent.Service + "\x00" + consent.Provider))
+	return hex.EncodeToString(hash[:])
+}
+
+// GetConsentsByDedupKey returns all consents with the given dedup key, i.e. those of one user for
+// the same service and provider.
+func (s *SmartContract) GetConsentsByDedupKey(ctx contractapi.TransactionContextInterface, key string) ([]*Consent, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(dedupIndex, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	consents := []*Consent{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		consent, err := s.ReadConsent(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		consents = append(consents, consent)
+	}
+
+	return consents, nil
+}
+
+// assertNoActiveDuplicate returns an error when the user already has an active consent for the
+// same service, provider and purpose as the given new one. It looks the candidates up in the dedup
+// index, so it works without CouchDB but cannot see consents written before the index existed until
+// they have been migrated.
+func (s *SmartContract) assertNoActiveDuplicate(ctx contractapi.TransactionContextInterface, consent *Consent) error {
+	key := dedupKey(consent)
+	if key == "" {
+		return nil
+	}
+	candidates, err := s.GetConsentsByDedupKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	for _, candidate := range candidates {
+		if candidate.Purpose == consent.Purpose && isActive(candidate, now) {
+			return fmt.Errorf("the user %s already has the active consent %s for service %s with provider %s and purpose %s; set forceCreate to create another", consent.UserID, candidate.ID, consent.Service, consent.Provider, consent.Purpose)
+		}
+	}
+
+	return nil
+}
+
+// FindDuplicateConsents returns the IDs of consents sharing a dedup key, keyed by that key, in a
+// single scan of the dedup index. Index entries are ordered by key, so duplicates are adjacent and
+// only one group is held at a time. Consents written before the index existed are only covered once
+// they have been migrated.
+func (s *SmartContract) FindDuplicateConsents(ctx contractapi.TransactionContextInterface) (map[string][]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(dedupIndex, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	duplicates := make(map[string][]string)
+	var groupKey string
+	var group []string
+	flush := func() {
+		if len(group) > 1 {
+			duplicates[groupKey] = group
+		}
+	}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		if attributes[0] != groupKey {
+			flush()
+			groupKey, group = attributes[0], nil
+		}
+		group = append(group, attributes[1])
+	}
+	flush()
+
+	return duplicates, nil
+}
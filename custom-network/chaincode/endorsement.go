@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// SetConsentEndorsementPolicy requires every write of the consent to be endorsed by a peer of each
+// of the given organizations, overriding the chaincode-wide endorsement policy for that key alone.
+// Once set, changing the policy again needs endorsement under the policy in force. The caller must
+// belong to the organization that created the consent and be an admin for its provider.
+func (s *SmartContract) SetConsentEndorsementPolicy(ctx contractapi.TransactionContextInterface, id string, orgs []string) error {
+	if len(orgs) == 0 {
+		return fmt.Errorf("at least one organization is required")
+	}
+	for _, org := range orgs {
+		if org == "" {
+			return fmt.Errorf("organization MSP IDs must not be empty")
+		}
+	}
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = assertOwnerMSP(ctx, consent)
+	if err != nil {
+		return err
+	}
+	err = assertProviderAdmin(ctx, consent.Provider)
+	if err != nil {
+		return err
+	}
+
+	endorsementPolicy, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	err = endorsementPolicy.AddOrgs(statebased.RoleTypePeer, orgs...)
+	if err != nil {
+		return err
+	}
+	policy, err := endorsementPolicy.Policy()
+	if err != nil {
+		return fmt.Errorf("failed to build endorsement policy: %v", err)
+	}
+
+	return ctx.GetStub().SetStateValidationParameter(id, policy)
+}
+
+// GetConsentEndorsementPolicy returns the sorted MSP IDs of the organizations whose endorsement a
+// write of the consent requires, or an empty list when the chaincode-wide policy applies.
+func (s *SmartContract) GetConsentEndorsementPolicy(ctx contractapi.TransactionContextInterface, id string) ([]string, error) {
+	exists, err := s.ConsentExists(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("the consent %s does not exist", id)
+	}
+
+	policy, err := ctx.GetStub().GetStateValidationParameter(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read endorsement policy: %v", err)
+	}
+	if len(policy) == 0 {
+		return []string{}, nil
+	}
+	endorsementPolicy, err := statebased.NewStateEP(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endorsement policy: %v", err)
+	}
+
+	orgs := endorsementPolicy.ListOrgs()
+	sort.Strings(orgs)
+	return orgs, nil
+}
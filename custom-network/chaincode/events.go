@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// emitEvent sets a chaincode event with a JSON encoded payload. Fabric delivers at most one
+// event per transaction, so a later call in the same transaction replaces an earlier one.
+func emitEvent(ctx contractapi.TransactionContextInterface, name string, payload interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent(name, payloadJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// consentChanged is the payload of the ConsentCreated and ConsentUpdated events.
+type consentChanged struct {
+	ID           string `json:"id"`
+	UserID       string `json:"userId"`
+	Provider     string `json:"provider"`
+	ConsentGiven bool   `json:"consentGiven"`
+}
+
+// consentDeleted is the payload of the ConsentDeleted event.
+type consentDeleted struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+}
+
+// emitConsentChanged sets the named change event for the consent written by the transaction.
+func emitConsentChanged(ctx contractapi.TransactionContextInterface, name string, consent *Consent) error {
+	return emitEvent(ctx, name, consentChanged{
+		ID:           consent.ID,
+		UserID:       consent.UserID,
+		Provider:     consent.Provider,
+		ConsentGiven: consent.ConsentGiven,
+	})
+}
+
+// consentScheduled is the payload of the ConsentScheduled event.
+type consentScheduled struct {
+	ID            string `json:"id"`
+	UserID        string `json:"userId"`
+	Provider      string `json:"provider"`
+	EffectiveFrom string `json:"effectiveFrom"`
+}
+
+// emitConsentCreated sets the creation event of a new consent: ConsentScheduled with its effective
+// date when it only takes effect later, ConsentCreated otherwise.
+func emitConsentCreated(ctx contractapi.TransactionContextInterface, consent *Consent) error {
+	if consent.ConsentGiven && consent.Status == statusPending {
+		return emitEvent(ctx, "ConsentScheduled", consentScheduled{
+			ID:            consent.ID,
+			UserID:        consent.UserID,
+			Provider:      consent.Provider,
+			EffectiveFrom: consent.EffectiveFrom,
+		})
+	}
+
+	return emitConsentChanged(ctx, "ConsentCreated", consent)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// SetExternalRef links a consent to its record in an external system, replacing any previous link
+// for that system. An external record can be linked to one consent only. The caller must belong to
+// the organization that created the consent and be an admin for its provider.
+func (s *SmartContract) SetExternalRef(ctx contractapi.TransactionContextInterface, id string, system string, extId string) error {
+	if system == "" || extId == "" {
+		return fmt.Errorf("the system and external id must not be empty")
+	}
+	consent, err := s.readConsentForChange(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	linkedId, err := getConsentIDByExternalRef(ctx, system, extId)
+	if err != nil {
+		return err
+	}
+	if linkedId == id {
+		return nil
+	}
+	if linkedId != "" {
+		return fmt.Errorf("external record %s/%s is already linked to consent %s", system, extId, linkedId)
+	}
+
+	if consent.ExternalRefs == nil {
+		consent.ExternalRefs = make(map[string]string)
+	}
+	consent.ExternalRefs[system] = extId
+
+	return putConsent(ctx, consent)
+}
+
+// GetConsentByExternalRef returns the consent linked to the given record of an external system.
+func (s *SmartContract) GetConsentByExternalRef(ctx contractapi.TransactionContextInterface, system string, extId string) (*Consent, error) {
+	id, err := getConsentIDByExternalRef(ctx, system, extId)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, fmt.Errorf("no consent is linked to external record %s/%s", system, extId)
+	}
+
+	return s.ReadConsent(ctx, id)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// HistoryEntry is one modification of a consent key. Value is nil for deletions
+type HistoryEntry struct {
+	TxID      string   `json:"txId"`
+	Timestamp string   `json:"timestamp"`
+	IsDelete  bool     `json:"isDelete"`
+	Value     *Consent `json:"value,omitempty" metadata:",optional"`
+}
+
+// GetConsentHistory returns every committed modification of the consent key in the order the
+// history database yields them, so auditors can show what the consent said at any point in time.
+// Timestamps are those of the modifying transactions, not the consent's own Timestamp field.
+func (s *SmartContract) GetConsentHistory(ctx contractapi.TransactionContextInterface, id string) ([]HistoryEntry, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(id)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	history := []HistoryEntry{}
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		entry := HistoryEntry{
+			TxID:      modification.TxId,
+			Timestamp: modification.Timestamp.AsTime().UTC().Format(time.RFC3339Nano),
+			IsDelete:  modification.IsDelete,
+		}
+		if !modification.IsDelete {
+			entry.Value = &Consent{}
+			err = json.Unmarshal(modification.Value, entry.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+// DatasetDiff lists the consents added, removed and modified between two points in time
+type DatasetDiff struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+// keyVersion is the state of a key at a point in time as reconstructed from its history.
+type keyVersion struct {
+	txId    string
+	consent *Consent
+}
+
+// DiffConsentsBetween reconstructs the state of every consent at t1 and at t2 from the ledger
+// history and reports which consents were added, removed or modified in between. A non-empty
+// provider limits the diff to consents that belonged to that provider at either time.
+//
+// This is expensive: it reads the full history of every live and every deleted consent key, so
+// the cost grows with the number of writes ever made, not with the number of changes in the
+// window. Run it as an evaluate-only query against a peer with the history database enabled.
+func (s *SmartContract) DiffConsentsBetween(ctx contractapi.TransactionContextInterface, t1 string, t2 string, provider string) (*DatasetDiff, error) {
+	from, to, err := parseDateRange(t1, t2)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		ids[consent.ID] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	deletedIds, err := getDeletedConsentIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range deletedIds {
+		ids[id] = true
+	}
+	sortedIds := make([]string, 0, len(ids))
+	for id := range ids {
+		sortedIds = append(sortedIds, id)
+	}
+	sort.Strings(sortedIds)
+
+	diff := &DatasetDiff{From: t1, To: t2, Added: []string{}, Removed: []string{}, Modified: []string{}}
+	for _, id := range sortedIds {
+		before, after, err := versionsAt(ctx, id, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if provider != "" && !ownedBy(before, provider) && !ownedBy(after, provider) {
+			continue
+		}
+
+		switch {
+		case before.consent == nil && after.consent != nil:
+			diff.Added = append(diff.Added, id)
+		case before.consent != nil && after.consent == nil:
+			diff.Removed = append(diff.Removed, id)
+		case before.consent != nil && before.txId != after.txId:
+			diff.Modified = append(diff.Modified, id)
+		}
+	}
+
+	return diff, nil
+}
+
+// versionsAt returns the versions of a key in effect at the two given times. A version without a
+// consent means the key did not exist or had been deleted at that time.
+func versionsAt(ctx contractapi.TransactionContextInterface, id string, t1 time.Time, t2 time.Time) (keyVersion, keyVersion, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(id)
+	if err != nil {
+		return keyVersion{}, keyVersion{}, err
+	}
+	defer resultsIterator.Close()
+
+	var before, after keyVersion
+	var beforeAt, afterAt time.Time
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return keyVersion{}, keyVersion{}, err
+		}
+		at := modification.Timestamp.AsTime()
+		if at.After(t2) {
+			continue
+		}
+
+		version := keyVersion{txId: modification.TxId}
+		if !modification.IsDelete {
+			version.consent = &Consent{}
+			err = json.Unmarshal(modification.Value, version.consent)
+			if err != nil {
+				return keyVersion{}, keyVersion{}, err
+			}
+		}
+		if !at.Before(afterAt) {
+			after, afterAt = version, at
+		}
+		if !at.After(t1) && !at.Before(beforeAt) {
+			before, beforeAt = version, at
+		}
+	}
+
+	return before, after, nil
+}
+
+// ownedBy returns true when the version holds a consent for the given provider.
+func ownedBy(version keyVersion, provider string) bool {
+	return version.consent != nil && version.consent.Provider == provider
+}
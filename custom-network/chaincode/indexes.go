@@ -0,0 +1,202 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Composite key namespaces of the secondary indexes maintained alongside each consent.
+const (
+	parentChildIndex = "parent~child"
+	externalRefIndex = "system~extId~id"
+	tombstoneIndex   = "deleted~id"
+	dedupIndex       = "dedupKey~id"
+	providerIndex    = "provider~user~id"
+)
+
+// indexValue is stored under index keys, which carry all their information in the key itself.
+var indexValue = []byte{0x00}
+
+// consentIndexKeys returns the secondary index keys that should exist for the given consent.
+func consentIndexKeys(ctx contractapi.TransactionContextInterface, consent *Consent) ([]string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(providerIndex, []string{consent.Provider, consent.UserID, consent.ID})
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{key}
+
+	if consent.ParentID != "" {
+		key, err := ctx.GetStub().CreateCompositeKey(parentChildIndex, []string{consent.ParentID, consent.ID})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if consent.DedupKey != "" {
+		key, err := ctx.GetStub().CreateCompositeKey(dedupIndex, []string{consent.DedupKey, consent.ID})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	systems := make([]string, 0, len(consent.ExternalRefs))
+	for system := range consent.ExternalRefs {
+		systems = append(systems, system)
+	}
+	sort.Strings(systems)
+	for _, system := range systems {
+		key, err := ctx.GetStub().CreateCompositeKey(externalRefIndex, []string{system, consent.ExternalRefs[system], consent.ID})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// updateConsentIndexes deletes the index entries of the previous version of a consent that no
+// longer apply and writes those of the current version. Either version may be nil.
+func updateConsentIndexes(ctx contractapi.TransactionContextInterface, previous *Consent, current *Consent) error {
+	var previousKeys, currentKeys []string
+	var err error
+	if previous != nil {
+		previousKeys, err = consentIndexKeys(ctx, previous)
+		if err != nil {
+			return err
+		}
+	}
+	if current != nil {
+		currentKeys, err = consentIndexKeys(ctx, current)
+		if err != nil {
+			return err
+		}
+	}
+
+	wanted := make(map[string]bool)
+	for _, key := range currentKeys {
+		wanted[key] = true
+	}
+	for _, key := range previousKeys {
+		if wanted[key] {
+			// already indexed, nothing to write
+			delete(wanted, key)
+			continue
+		}
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range currentKeys {
+		if !wanted[key] {
+			continue
+		}
+		err = ctx.GetStub().PutState(key, indexValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getChildConsentIDs returns the IDs of the consents directly derived from the given parent.
+func getChildConsentIDs(ctx contractapi.TransactionContextInterface, parentId string) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(parentChildIndex, []string{parentId})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var ids []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, attributes[1])
+	}
+
+	return ids, nil
+}
+
+// getConsentIDByExternalRef returns the ID of the consent linked to the given external record, or ""
+// when there is none.
+func getConsentIDByExternalRef(ctx contractapi.TransactionContextInterface, system string, extId string) (string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(externalRefIndex, []string{system, extId})
+	if err != nil {
+		return "", err
+	}
+	defer resultsIterator.Close()
+
+	if !resultsIterator.HasNext() {
+		return "", nil
+	}
+	queryResponse, err := resultsIterator.Next()
+	if err != nil {
+		return "", err
+	}
+	_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+	if err != nil {
+		return "", err
+	}
+
+	return attributes[2], nil
+}
+
+// getDeletedConsentIDs returns the IDs of all consents that have ever been deleted.
+func getDeletedConsentIDs(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(tombstoneIndex, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var ids []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, attributes[0])
+	}
+
+	return ids, nil
+}
+
+// getConsentIDsByProvider returns the IDs of the consents of the given provider from the
+// provider~user~id index, ordered by user.
+func getConsentIDsByProvider(ctx contractapi.TransactionContextInterface, provider string) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(providerIndex, []string{provider})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var ids []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, attributes[2])
+	}
+
+	return ids, nil
+}
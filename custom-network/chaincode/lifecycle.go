@@ -0,0 +1,902 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// duplicateResolution is the payload of the DuplicateConsentsResolved event.
+type duplicateResolution struct {
+	UserID     string   `json:"userId"`
+	Service    string   `json:"service"`
+	Provider   string   `json:"provider"`
+	SurvivorID string   `json:"survivorId"`
+	RevokedIDs []string `json:"revokedIds"`
+}
+
+// ResolveDuplicateConsents keeps the most recently created active consent for the given user,
+// service and provider and revokes every other active one with reason "duplicate-resolved".
+// When creation timestamps are equal the lexicographically greatest ID survives. The ID of the
+// surviving consent is returned and a single DuplicateConsentsResolved event lists the revoked IDs.
+// The caller must be an admin for the provider, and the call fails without revoking anything if a
+// consent it would revoke is owned by another organization.
+func (s *SmartContract) ResolveDuplicateConsents(ctx contractapi.TransactionContextInterface, userId string, service string, provider string) (string, error) {
+	err := assertProviderAdmin(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"userId":"%s","service":"%s","provider":"%s"}}`, userId, service, provider)
+	consents, err := getQueryResultForQueryString(ctx, queryString)
+	if err != nil {
+		return "", err
+	}
+
+	var active []*Consent
+	for _, consent := range consents {
+		if isActive(consent, now) {
+			active = append(active, consent)
+		}
+	}
+	if len(active) == 0 {
+		return "", fmt.Errorf("no active consents found for user %s, service %s and provider %s", userId, service, provider)
+	}
+
+	// newest first, ties broken by descending ID
+	sort.Slice(active, func(i, j int) bool {
+		ti, tj := createdAt(active[i]), createdAt(active[j])
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return active[i].ID > active[j].ID
+	})
+
+	resolution := duplicateResolution{
+		UserID:     userId,
+		Service:    service,
+		Provider:   provider,
+		SurvivorID: active[0].ID,
+		RevokedIDs: []string{},
+	}
+	for _, consent := range active[1:] {
+		err = assertOwnerMSP(ctx, consent)
+		if err != nil {
+			return "", err
+		}
+	}
+	for _, consent := range active[1:] {
+		err = revokeConsent(consent, "duplicate-resolved", now)
+		if err != nil {
+			return "", err
+		}
+		err = putConsent(ctx, consent)
+		if err != nil {
+			return "", err
+		}
+		resolution.RevokedIDs = append(resolution.RevokedIDs, consent.ID)
+	}
+
+	if len(resolution.RevokedIDs) > 0 {
+		err = emitEvent(ctx, "DuplicateConsentsResolved", resolution)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return resolution.SurvivorID, nil
+}
+
+// consentReactivation is the payload of the ConsentReactivated event.
+type consentReactivation struct {
+	ID                 string `json:"id"`
+	UserID             string `json:"userId"`
+	PreviousExpiration string `json:"previousExpiration"`
+	NewExpiration      string `json:"newExpiration"`
+}
+
+// ReactivateConsent brings an expired consent back into effect with a new expiration date, keeping
+// its ID, purpose and ledger history. It is only allowed within the soft-expire window:
+//
+//	active  --expiry-->  expired (soft)  --ReactivateConsent-->  active
+//	expired (soft)  --window elapses-->  expired (hard)
+//
+// Hard-expired and revoked consents cannot be reactivated and must be granted again from scratch.
+// The caller must be the consent's user or an admin for its provider.
+func (s *SmartContract) ReactivateConsent(ctx contractapi.TransactionContextInterface, id string, newExpirationDate string) error {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = assertUserOrProviderAdmin(ctx, consent)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	if status := consentStatus(consent, now); status != statusExpired {
+		return fmt.Errorf("the consent %s is %s, only expired consents can be reactivated", id, status)
+	}
+	err = assertTransition(consent, statusActive, now)
+	if err != nil {
+		return err
+	}
+	windowDays, err := s.GetSoftExpireWindowDays(ctx)
+	if err != nil {
+		return err
+	}
+	err = assertWithinSoftExpireWindow(consent, now, windowDays)
+	if err != nil {
+		return err
+	}
+
+	newExpiration, err := parseConsentDate("newExpirationDate", newExpirationDate)
+	if err != nil {
+		return err
+	}
+	if !newExpiration.After(now) {
+		return fmt.Errorf("newExpirationDate %s must be after the transaction time", newExpirationDate)
+	}
+
+	reactivation := consentReactivation{
+		ID:                 id,
+		UserID:             consent.UserID,
+		PreviousExpiration: consent.ExpirationDate,
+		NewExpiration:      newExpirationDate,
+	}
+	consent.ExpirationDate = newExpirationDate
+	err = applyRegionExpiryCap(ctx, consent, now)
+	if err != nil {
+		return err
+	}
+	reactivation.NewExpiration = consent.ExpirationDate
+	err = putConsent(ctx, consent)
+	if err != nil {
+		return err
+	}
+	err = putExpiryChange(ctx, id, reactivation.PreviousExpiration, reactivation.NewExpiration)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, "ConsentReactivated", reactivation)
+}
+
+// consentRenewal is the payload of the ConsentRenewed event.
+type consentRenewal struct {
+	ID                 string `json:"id"`
+	UserID             string `json:"userId"`
+	Timestamp          string `json:"timestamp"`
+	PreviousExpiration string `json:"previousExpiration"`
+	NewExpiration      string `json:"newExpiration"`
+}
+
+// RenewConsent moves the expiration of a consent to newExpirationDate and its timestamp to the given
+// renewal time, leaving every other field untouched. The new expiration must be later than the
+// current one, the timestamp and the transaction time. Revoked consents cannot be renewed, and
+// expired ones only within the soft-expire window; older consents must be created afresh. The
+// caller must be the consent's user or an admin for its provider.
+func (s *SmartContract) RenewConsent(ctx contractapi.TransactionContextInterface, id string, newExpirationDate string, timestamp string) error {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = assertUserOrProviderAdmin(ctx, consent)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	// consents SetConsentStatus marked expired are withdrawn, not merely past their expiration date
+	status := consentStatus(consent, now)
+	if !consent.ConsentGiven || (status != statusActive && status != statusExpired) {
+		return fmt.Errorf("the consent %s is %s, only active or expired consents can be renewed", id, status)
+	}
+	expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+	if err != nil {
+		return err
+	}
+	if status == statusExpired {
+		windowDays, err := s.GetSoftExpireWindowDays(ctx)
+		if err != nil {
+			return err
+		}
+		err = assertWithinSoftExpireWindow(consent, now, windowDays)
+		if err != nil {
+			return err
+		}
+	}
+	newExpiration, err := parseConsentDate("newExpirationDate", newExpirationDate)
+	if err != nil {
+		return err
+	}
+	if !newExpiration.After(expiration) {
+		return fmt.Errorf("newExpirationDate %s must be after the current expirationDate %s", newExpirationDate, consent.ExpirationDate)
+	}
+	if !newExpiration.After(now) {
+		return fmt.Errorf("newExpirationDate %s must be after the transaction time", newExpirationDate)
+	}
+
+	renewed := *consent
+	renewed.Timestamp = timestamp
+	renewed.ExpirationDate = newExpirationDate
+	err = validateConsentDates(&renewed)
+	if err != nil {
+		return err
+	}
+	err = applyRegionExpiryCap(ctx, &renewed, now)
+	if err != nil {
+		return err
+	}
+	err = assertTransition(consent, consentStatus(&renewed, now), now)
+	if err != nil {
+		return err
+	}
+
+	err = putConsent(ctx, &renewed)
+	if err != nil {
+		return err
+	}
+	err = putExpiryChange(ctx, id, consent.ExpirationDate, renewed.ExpirationDate)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, "ConsentRenewed", consentRenewal{
+		ID:                 id,
+		UserID:             consent.UserID,
+		Timestamp:          renewed.Timestamp,
+		PreviousExpiration: consent.ExpirationDate,
+		NewExpiration:      renewed.ExpirationDate,
+	})
+}
+
+// consentTransfer is the payload of the ConsentTransferred event.
+type consentTransfer struct {
+	ID          string `json:"id"`
+	UserID      string `json:"userId"`
+	OldProvider string `json:"oldProvider"`
+	NewProvider string `json:"newProvider"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// TransferConsent moves a consent to another provider in place, e.g. when the user ports their
+// number, so its ID and therefore its GetConsentHistory lineage are kept. The timestamp is set to the
+// transaction time and the old values are kept in PreviousValues. Revoked and expired consents
+// cannot be transferred, and the new provider must offer the consent's service. The caller must
+// belong to the organization that created the consent and be an admin for both providers.
+func (s *SmartContract) TransferConsent(ctx contractapi.TransactionContextInterface, id string, newProvider string) error {
+	newProvider, err := normalizeProvider(newProvider)
+	if err != nil {
+		return err
+	}
+	existing, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	if newProvider == existing.Provider {
+		return fmt.Errorf("the consent %s is already with provider %s", id, newProvider)
+	}
+	err = assertOwnerMSP(ctx, existing)
+	if err != nil {
+		return err
+	}
+	err = assertProviderAdmin(ctx, existing.Provider)
+	if err != nil {
+		return err
+	}
+	err = assertProviderAdmin(ctx, newProvider)
+	if err != nil {
+		return err
+	}
+	err = validateServiceForProvider(ctx, existing.Service, newProvider)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if status := consentStatus(existing, now); status != statusActive && status != statusPending {
+		return fmt.Errorf("the consent %s is %s, only active or pending consents can be transferred", id, status)
+	}
+
+	consent := *existing
+	timestamp := now.UTC().Format(time.RFC3339)
+	consent.PreviousValues = changedFields(existing, map[string]string{
+		"provider":  newProvider,
+		"timestamp": timestamp,
+	})
+	consent.Provider = newProvider
+	consent.Timestamp = timestamp
+	err = validateConsentDates(&consent)
+	if err != nil {
+		return err
+	}
+
+	err = putConsent(ctx, &consent)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, "ConsentTransferred", consentTransfer{
+		ID:          id,
+		UserID:      consent.UserID,
+		OldProvider: existing.Provider,
+		NewProvider: newProvider,
+		Timestamp:   timestamp,
+	})
+}
+
+// CreateChildConsent issues a consent scoped under an active parent consent. The child inherits the
+// parent's user, provider, collection method, terms version, region and age verification; an empty
+// purpose or expirationDate is inherited from the parent too. The caller must be the parent's user
+// or an admin for its provider. A ConsentCreated event is emitted for the child.
+func (s *SmartContract) CreateChildConsent(ctx contractapi.TransactionContextInterface, parentId string, id string, service string, purpose string, expirationDate string, timestamp string) error {
+	if id == parentId {
+		return fmt.Errorf("the consent %s cannot be its own parent", id)
+	}
+	parent, err := s.ReadConsent(ctx, parentId)
+	if err != nil {
+		return err
+	}
+	err = assertUserOrProviderAdmin(ctx, parent)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !isActive(parent, now) {
+		return fmt.Errorf("the parent consent %s is not active", parentId)
+	}
+
+	exists, err := s.ConsentExists(ctx, id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the consent %s already exists", id)
+	}
+	err = assertNoAncestor(ctx, parent, id)
+	if err != nil {
+		return err
+	}
+
+	if purpose == "" {
+		purpose = parent.Purpose
+	}
+	if expirationDate == "" {
+		expirationDate = parent.ExpirationDate
+	}
+	child := Consent{
+		ID:               id,
+		UserID:           parent.UserID,
+		Service:          service,
+		Provider:         parent.Provider,
+		ConsentGiven:     true,
+		Timestamp:        timestamp,
+		ExpirationDate:   expirationDate,
+		Purpose:          purpose,
+		ParentID:         parentId,
+		CollectionMethod: parent.CollectionMethod,
+		TermsVersion:     parent.TermsVersion,
+		Region:           parent.Region,
+		AgeVerified:      parent.AgeVerified,
+	}
+	err = validateNewConsent(ctx, &child)
+	if err != nil {
+		return err
+	}
+
+	err = putConsent(ctx, &child)
+	if err != nil {
+		return err
+	}
+
+	return emitConsentCreated(ctx, &child)
+}
+
+// assertNoAncestor walks up the parent chain of consent and fails if id already appears in it,
+// or if the chain itself loops, so linking id under consent can never form a cycle.
+func assertNoAncestor(ctx contractapi.TransactionContextInterface, consent *Consent, id string) error {
+	visited := map[string]bool{consent.ID: true}
+	for consent.ParentID != "" {
+		if consent.ParentID == id || visited[consent.ParentID] {
+			return fmt.Errorf("linking consent %s under %s would create a cycle", id, consent.ID)
+		}
+		visited[consent.ParentID] = true
+
+		parentJSON, err := ctx.GetStub().GetState(consent.ParentID)
+		if err != nil {
+			return fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if parentJSON == nil {
+			return nil
+		}
+		consent = &Consent{}
+		err = json.Unmarshal(parentJSON, consent)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cascadeRevocation is the payload of the ConsentRevokedCascade event.
+type cascadeRevocation struct {
+	RootID     string   `json:"rootId"`
+	Reason     string   `json:"reason"`
+	RevokedIDs []string `json:"revokedIds"`
+}
+
+// RevokeConsentCascade revokes a consent together with all of its descendants and returns how many
+// consents were revoked. Descendants that are already revoked, or owned by another organization,
+// are left unchanged, though their own descendants are still visited. Each consent is visited at
+// most once, so a corrupted parent chain cannot loop forever. The caller must belong to the
+// organization that created the root consent and be an admin for its provider.
+func (s *SmartContract) RevokeConsentCascade(ctx contractapi.TransactionContextInterface, id string, reason string) (int, error) {
+	root, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	err = assertOwnerMSP(ctx, root)
+	if err != nil {
+		return 0, err
+	}
+	err = assertProviderAdmin(ctx, root.Provider)
+	if err != nil {
+		return 0, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	revocation := cascadeRevocation{RootID: id, Reason: reason, RevokedIDs: []string{}}
+	visited := make(map[string]bool)
+	queue := []string{id}
+	for len(queue) > 0 {
+		currentId := queue[0]
+		queue = queue[1:]
+		if visited[currentId] {
+			continue
+		}
+		visited[currentId] = true
+
+		consentJSON, err := ctx.GetStub().GetState(currentId)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if consentJSON == nil {
+			continue
+		}
+		var consent Consent
+		err = json.Unmarshal(consentJSON, &consent)
+		if err != nil {
+			return 0, err
+		}
+
+		if consent.ConsentGiven && assertOwnerMSP(ctx, &consent) == nil {
+			err = revokeConsent(&consent, reason, now)
+			if err != nil {
+				return 0, err
+			}
+			err = putConsent(ctx, &consent)
+			if err != nil {
+				return 0, err
+			}
+			revocation.RevokedIDs = append(revocation.RevokedIDs, consent.ID)
+		}
+
+		children, err := getChildConsentIDs(ctx, currentId)
+		if err != nil {
+			return 0, err
+		}
+		queue = append(queue, children...)
+	}
+
+	err = emitEvent(ctx, "ConsentRevokedCascade", revocation)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(revocation.RevokedIDs), nil
+}
+
+// AddConsentTag attaches a tag to a consent, e.g. the campaign it was collected in. Adding a tag
+// the consent already has is a no-op. The caller must belong to the organization that created the
+// consent and be an admin for its provider.
+func (s *SmartContract) AddConsentTag(ctx contractapi.TransactionContextInterface, id string, tag string) error {
+	if tag == "" {
+		return fmt.Errorf("the tag must not be empty")
+	}
+	consent, err := s.readConsentForChange(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range consent.Tags {
+		if existing == tag {
+			return nil
+		}
+	}
+	consent.Tags = append(consent.Tags, tag)
+
+	return putConsent(ctx, consent)
+}
+
+// SetConsentRetentionCategory assigns one of the allowed retention categories to a consent. The
+// caller must belong to the organization that created the consent and be an admin for its provider.
+func (s *SmartContract) SetConsentRetentionCategory(ctx contractapi.TransactionContextInterface, id string, category string) error {
+	err := validateRetentionCategory(ctx, category)
+	if err != nil {
+		return err
+	}
+	consent, err := s.readConsentForChange(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	consent.RetentionCategory = category
+	return putConsent(ctx, consent)
+}
+
+// tagRevocation is the payload of the ConsentsRevokedByTag event.
+type tagRevocation struct {
+	Tag        string   `json:"tag"`
+	Reason     string   `json:"reason"`
+	Count      int      `json:"count"`
+	RevokedIDs []string `json:"revokedIds"`
+}
+
+// RevokeConsentsByTag revokes every granted consent carrying the tag, in ID order, and returns
+// how many were revoked. Consents owned by another organization are skipped. The caller must be an
+// admin for the provider of every consent revoked.
+func (s *SmartContract) RevokeConsentsByTag(ctx contractapi.TransactionContextInterface, tag string, reason string) (int, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	consents, err := s.GetConsentsByTag(ctx, tag)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(consents, func(i, j int) bool {
+		return consents[i].ID < consents[j].ID
+	})
+
+	revocation := tagRevocation{Tag: tag, Reason: reason, RevokedIDs: []string{}}
+	for _, consent := range consents {
+		if !consent.ConsentGiven || assertOwnerMSP(ctx, consent) != nil {
+			continue
+		}
+		err = assertProviderAdmin(ctx, consent.Provider)
+		if err != nil {
+			return 0, err
+		}
+
+		err = revokeConsent(consent, reason, now)
+		if err != nil {
+			return 0, err
+		}
+		err = putConsent(ctx, consent)
+		if err != nil {
+			return 0, err
+		}
+		revocation.RevokedIDs = append(revocation.RevokedIDs, consent.ID)
+	}
+	revocation.Count = len(revocation.RevokedIDs)
+
+	err = emitEvent(ctx, "ConsentsRevokedByTag", revocation)
+	if err != nil {
+		return 0, err
+	}
+
+	return revocation.Count, nil
+}
+
+// consentExtension is the payload of the ConsentExtended event.
+type consentExtension struct {
+	ID                 string `json:"id"`
+	PreviousExpiration string `json:"previousExpiration"`
+	NewExpiration      string `json:"newExpiration"`
+}
+
+// ExtendConsent pushes the expiration of a consent back by duration, given in days ("30d") or Go
+// duration syntax ("720h"), and adds the change to the consent's expiry audit trail. Revoked
+// consents cannot be extended, nor can consents that expired longer ago than the soft-expire window.
+// The caller must be the consent's user or an admin for its provider.
+func (s *SmartContract) ExtendConsent(ctx contractapi.TransactionContextInterface, id string, duration string) error {
+	d, err := parseExtension(duration)
+	if err != nil {
+		return err
+	}
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = assertUserOrProviderAdmin(ctx, consent)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	windowDays, err := s.GetSoftExpireWindowDays(ctx)
+	if err != nil {
+		return err
+	}
+
+	extension := consentExtension{ID: id, PreviousExpiration: consent.ExpirationDate}
+	err = extendConsent(consent, d, now, windowDays)
+	if err != nil {
+		return err
+	}
+	err = applyRegionExpiryCap(ctx, consent, now)
+	if err != nil {
+		return err
+	}
+	err = putConsent(ctx, consent)
+	if err != nil {
+		return err
+	}
+	extension.NewExpiration = consent.ExpirationDate
+	err = putExpiryChange(ctx, id, extension.PreviousExpiration, extension.NewExpiration)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, "ConsentExtended", extension)
+}
+
+// extendConsent moves the expiration of a non-revoked consent back by d. A consent that expired
+// more than windowDays ago stays expired.
+func extendConsent(consent *Consent, d time.Duration, now time.Time, windowDays int) error {
+	if !consent.ConsentGiven {
+		return fmt.Errorf("the consent %s is revoked", consent.ID)
+	}
+	err := assertWithinSoftExpireWindow(consent, now, windowDays)
+	if err != nil {
+		return err
+	}
+
+	extended := *consent
+	expirationDate, err := addToConsentDate("expirationDate", consent.ExpirationDate, d)
+	if err != nil {
+		return err
+	}
+	extended.ExpirationDate = expirationDate
+	err = assertTransition(consent, consentStatus(&extended, now), now)
+	if err != nil {
+		return err
+	}
+	consent.ExpirationDate = expirationDate
+
+	return nil
+}
+
+// SetConsentEffectiveFrom schedules a consent to take effect at effectiveFrom, which must be before
+// its expiration date; an empty value puts it in effect immediately. A consent already in effect
+// cannot be moved back to pending. A ConsentScheduled event announces a future effective date. The
+// caller must belong to the organization that created the consent and be an admin for its provider.
+func (s *SmartContract) SetConsentEffectiveFrom(ctx contractapi.TransactionContextInterface, id string, effectiveFrom string) error {
+	consent, err := s.readConsentForChange(ctx, id)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	scheduled := *consent
+	scheduled.EffectiveFrom = normalizeConsentDate(effectiveFrom)
+	err = validateConsentDates(&scheduled)
+	if err != nil {
+		return err
+	}
+	err = assertTransition(consent, consentStatus(&scheduled, now), now)
+	if err != nil {
+		return err
+	}
+	consent.EffectiveFrom = scheduled.EffectiveFrom
+	err = putConsent(ctx, consent)
+	if err != nil {
+		return err
+	}
+	if !consent.ConsentGiven || consent.Status != statusPending {
+		return nil
+	}
+
+	return emitEvent(ctx, "ConsentScheduled", consentScheduled{
+		ID:            consent.ID,
+		UserID:        consent.UserID,
+		Provider:      consent.Provider,
+		EffectiveFrom: consent.EffectiveFrom,
+	})
+}
+
+// assertWithinSoftExpireWindow fails if the consent expired more than windowDays before now; past
+// that point it is hard-expired and can only be granted again.
+func assertWithinSoftExpireWindow(consent *Consent, now time.Time, windowDays int) error {
+	expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+	if err != nil {
+		return err
+	}
+	if now.After(expiration.AddDate(0, 0, windowDays)) {
+		return fmt.Errorf("the consent %s expired more than %d days ago and must be granted again", consent.ID, windowDays)
+	}
+
+	return nil
+}
+
+// RevokeConsent withdraws a consent, setting its Timestamp to the given value and leaving every other
+// caller-supplied field untouched. Revoking a consent that is not given is a no-op. The caller must
+// belong to the organization that created the consent and be its user or an admin for its provider.
+func (s *SmartContract) RevokeConsent(ctx contractapi.TransactionContextInterface, id string, timestamp string) error {
+	return s.setConsentGiven(ctx, id, false, timestamp)
+}
+
+// GrantConsent gives a consent again, setting its Timestamp to the given value and leaving every
+// other caller-supplied field untouched. Granting a consent that is already given is a no-op. The
+// same permissions as for RevokeConsent apply.
+func (s *SmartContract) GrantConsent(ctx contractapi.TransactionContextInterface, id string, timestamp string) error {
+	return s.setConsentGiven(ctx, id, true, timestamp)
+}
+
+// setConsentGiven implements RevokeConsent and GrantConsent.
+func (s *SmartContract) setConsentGiven(ctx contractapi.TransactionContextInterface, id string, given bool, timestamp string) error {
+	_, err := parseConsentDate("timestamp", timestamp)
+	if err != nil {
+		return err
+	}
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = assertOwnerMSP(ctx, consent)
+	if err != nil {
+		return err
+	}
+	err = assertUserOrProviderAdmin(ctx, consent)
+	if err != nil {
+		return err
+	}
+	if consent.ConsentGiven == given {
+		return nil
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	if given {
+		granted := *consent
+		granted.ConsentGiven = true
+		granted.OptedOut = false
+		err = assertTransition(consent, consentStatus(&granted, now), now)
+		if err != nil {
+			return err
+		}
+		consent = &granted
+	} else {
+		err = revokeConsent(consent, "", now)
+		if err != nil {
+			return err
+		}
+	}
+	consent.Timestamp = normalizeConsentDate(timestamp)
+
+	err = putConsent(ctx, consent)
+	if err != nil {
+		return err
+	}
+
+	return emitConsentChanged(ctx, "ConsentUpdated", consent)
+}
+
+// legalHold is the payload of the ConsentFrozen and ConsentUnfrozen events.
+type legalHold struct {
+	ConsentID string `json:"consentId"`
+	Frozen    bool   `json:"frozen"`
+	By        string `json:"by"`
+}
+
+// FreezeConsent places a consent under legal hold, after which every update, revocation and delete
+// is rejected until UnfreezeConsent releases it; reads remain allowed. Only admins may freeze
+// consents, and each freeze is recorded by a ConsentFrozen event naming the caller.
+func (s *SmartContract) FreezeConsent(ctx contractapi.TransactionContextInterface, id string) error {
+	return s.setLegalHold(ctx, id, true)
+}
+
+// UnfreezeConsent releases a consent from legal hold, recorded by a ConsentUnfrozen event.
+func (s *SmartContract) UnfreezeConsent(ctx contractapi.TransactionContextInterface, id string) error {
+	return s.setLegalHold(ctx, id, false)
+}
+
+// setLegalHold implements FreezeConsent and UnfreezeConsent.
+func (s *SmartContract) setLegalHold(ctx contractapi.TransactionContextInterface, id string, frozen bool) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	if consent.Frozen == frozen {
+		if frozen {
+			return fmt.Errorf("the consent %s is already under legal hold", id)
+		}
+		return fmt.Errorf("the consent %s is not under legal hold", id)
+	}
+	by, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	consent.Frozen = frozen
+	err = writeConsent(ctx, consent, !frozen)
+	if err != nil {
+		return err
+	}
+
+	name := "ConsentUnfrozen"
+	if frozen {
+		name = "ConsentFrozen"
+	}
+	return emitEvent(ctx, name, legalHold{ConsentID: id, Frozen: frozen, By: by})
+}
+
+// assertNotFrozen returns a legal-hold error when the consent is frozen.
+func assertNotFrozen(consent *Consent) error {
+	if consent.Frozen {
+		return fmt.Errorf("the consent %s is under legal hold and cannot be modified", consent.ID)
+	}
+
+	return nil
+}
+
+// revokeConsent withdraws the consent at the given time, recording why it was revoked.
+func revokeConsent(consent *Consent, reason string, now time.Time) error {
+	err := assertTransition(consent, statusRevoked, now)
+	if err != nil {
+		return err
+	}
+
+	consent.ConsentGiven = false
+	consent.Status = statusRevoked
+	consent.RevokedAt = now.UTC().Format(time.RFC3339)
+	consent.RevocationReason = reason
+
+	return nil
+}
+
+// createdAt returns the parsed creation timestamp of a consent, or the zero time if it is invalid.
+func createdAt(consent *Consent) time.Time {
+	t, err := parseConsentDate("timestamp", consent.Timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
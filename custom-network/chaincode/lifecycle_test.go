@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestSetConsentEffectiveFrom(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expiration := now.AddDate(0, 0, 30)
+
+	tests := []struct {
+		name          string
+		effectiveFrom string // stored before the call
+		newValue      string
+		wantErr       bool
+		wantStatus    string
+		wantEvent     bool
+	}{
+		{"schedules a pending consent later", now.AddDate(0, 0, 1).Format(time.RFC3339), now.AddDate(0, 0, 2).Format(time.RFC3339), false, statusPending, true},
+		{"puts a pending consent in effect", now.AddDate(0, 0, 1).Format(time.RFC3339), "", false, statusActive, false},
+		{"rejects moving an active consent back to pending", "", now.AddDate(0, 0, 1).Format(time.RFC3339), true, "", false},
+		{"rejects a date at expiry", "", expiration.Format(time.RFC3339), true, "", false},
+		{"rejects an unparseable date", "", "tomorrow", true, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stub := newTestContext(t, now)
+			s := &SmartContract{}
+			consent := testConsent("consent1", now)
+			consent.EffectiveFrom = tt.effectiveFrom
+			consent.ExpirationDate = expiration.Format(time.RFC3339)
+			err := putConsent(ctx, consent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stub.TxTimestamp = timestamppb.New(now)
+
+			err = s.SetConsentEffectiveFrom(ctx, "consent1", tt.newValue)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("SetConsentEffectiveFrom succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := s.ReadConsent(ctx, "consent1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.EffectiveFrom != tt.newValue || stored.Status != tt.wantStatus {
+				t.Errorf("effectiveFrom %q, status %q, want %q, %q", stored.EffectiveFrom, stored.Status, tt.newValue, tt.wantStatus)
+			}
+			scheduled := false
+			for len(stub.ChaincodeEventsChannel) > 0 {
+				if (<-stub.ChaincodeEventsChannel).EventName == "ConsentScheduled" {
+					scheduled = true
+				}
+			}
+			if scheduled != tt.wantEvent {
+				t.Errorf("ConsentScheduled emitted: %t, want %t", scheduled, tt.wantEvent)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// SetConsentMetadata sets a free-form metadata attribute of a consent, replacing any previous value.
+// An empty value deletes the attribute. The caller must belong to the organization that created the
+// consent and be an admin for its provider.
+func (s *SmartContract) SetConsentMetadata(ctx contractapi.TransactionContextInterface, id string, key string, value string) error {
+	if key == "" {
+		return fmt.Errorf("the metadata key must not be empty")
+	}
+	consent, err := s.readConsentForChange(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if value == "" {
+		if _, ok := consent.Metadata[key]; !ok {
+			return nil
+		}
+		delete(consent.Metadata, key)
+		if len(consent.Metadata) == 0 {
+			consent.Metadata = nil
+		}
+		return putConsent(ctx, consent)
+	}
+	if consent.Metadata[key] == value {
+		return nil
+	}
+	if consent.Metadata == nil {
+		consent.Metadata = make(map[string]string)
+	}
+	consent.Metadata[key] = value
+
+	return putConsent(ctx, consent)
+}
+
+// GetConsentMetadata returns the value of a metadata attribute of a consent.
+func (s *SmartContract) GetConsentMetadata(ctx contractapi.TransactionContextInterface, id string, key string) (string, error) {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	value, ok := consent.Metadata[key]
+	if !ok {
+		return "", fmt.Errorf("the consent %s has no metadata %q", id, key)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// schemaMigrations upgrade a stored consent by one schema version each: entry i moves a record
+// from version i to version i+1. Records written before versioning was introduced are version 0.
+var schemaMigrations = []func(*Consent) error{
+	// 0 -> 1: legacy records get the standard retention category
+	func(consent *Consent) error {
+		_, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+		if err != nil {
+			return err
+		}
+		if consent.RetentionCategory == "" {
+			consent.RetentionCategory = "standard"
+		}
+		return nil
+	},
+	// 1 -> 2: records get the dedup key used by the duplicate index
+	func(consent *Consent) error {
+		consent.DedupKey = dedupKey(consent)
+		return nil
+	},
+	// 2 -> 3: records get the provider~user~id index entry, written when the record is stored
+	func(consent *Consent) error {
+		return nil
+	},
+}
+
+// currentSchemaVersion is the schema version every consent is written with.
+var currentSchemaVersion = len(schemaMigrations)
+
+// migrateConsent brings the consent up to the current schema version and reports whether it changed.
+func migrateConsent(consent *Consent) (bool, error) {
+	if consent.SchemaVersion > currentSchemaVersion {
+		return false, fmt.Errorf("the consent %s has unknown schema version %d", consent.ID, consent.SchemaVersion)
+	}
+
+	changed := false
+	for consent.SchemaVersion < currentSchemaVersion {
+		err := schemaMigrations[consent.SchemaVersion](consent)
+		if err != nil {
+			return false, fmt.Errorf("failed to migrate consent %s from schema version %d: %v", consent.ID, consent.SchemaVersion, err)
+		}
+		consent.SchemaVersion++
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// MigrateConsent upgrades a single consent to the current schema version and writes it back. A
+// consent that is already current is left untouched. Only admins may migrate consents.
+func (s *SmartContract) MigrateConsent(ctx contractapi.TransactionContextInterface, id string) error {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	changed, err := migrateConsent(consent)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	return putConsent(ctx, consent)
+}
+
+// MigrationReport summarizes a MigrateAllConsents run
+type MigrationReport struct {
+	DryRun          bool               `json:"dryRun"`
+	Migrated        int                `json:"migrated"`
+	Unchanged       int                `json:"unchanged"`
+	BySourceVersion map[string]int     `json:"bySourceVersion"`
+	Failures        []MigrationFailure `json:"failures"`
+}
+
+// MigrationFailure names a consent that could not be migrated and why
+type MigrationFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// MigrateAllConsents upgrades every consent to the current schema version. With dryRun set nothing
+// is written and the report describes what a real run would do: how many records would change,
+// which would fail, and how many records exist per source schema version.
+func (s *SmartContract) MigrateAllConsents(ctx contractapi.TransactionContextInterface, dryRun bool) (*MigrationReport, error) {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	report := &MigrationReport{
+		DryRun:          dryRun,
+		BySourceVersion: make(map[string]int),
+		Failures:        []MigrationFailure{},
+	}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var consent Consent
+		err = json.Unmarshal(queryResponse.Value, &consent)
+		if err != nil {
+			report.Failures = append(report.Failures, MigrationFailure{ID: queryResponse.Key, Error: err.Error()})
+			continue
+		}
+		report.BySourceVersion[strconv.Itoa(consent.SchemaVersion)]++
+
+		if consent.Frozen {
+			report.Failures = append(report.Failures, MigrationFailure{ID: queryResponse.Key, Error: assertNotFrozen(&consent).Error()})
+			continue
+		}
+		changed, err := migrateConsent(&consent)
+		if err != nil {
+			report.Failures = append(report.Failures, MigrationFailure{ID: queryResponse.Key, Error: err.Error()})
+			continue
+		}
+		if !changed {
+			report.Unchanged++
+			continue
+		}
+		report.Migrated++
+
+		if !dryRun {
+			err = putConsent(ctx, &consent)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// missingAuditFields reports whether the consent lacks any of the provenance fields written by
+// putConsent, as records created before they were introduced do.
+func missingAuditFields(consent *Consent) bool {
+	return consent.CreatedBy == "" || consent.CreatorMSP == "" || consent.UpdatedBy == "" || consent.UpdaterMSP == ""
+}
+
+// GetConsentsMissingAuditFields returns the consents that lack provenance fields, so that a backfill
+// job can target them incrementally.
+func (s *SmartContract) GetConsentsMissingAuditFields(ctx contractapi.TransactionContextInterface) ([]*Consent, error) {
+	consents := []*Consent{}
+	err := forEachConsent(ctx, func(consent *Consent) error {
+		if missingAuditFields(consent) {
+			consents = append(consents, consent)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return consents, nil
+}
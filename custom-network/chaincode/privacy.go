@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Transient fields read by the encrypted consent functions. Values passed in the transient map are
+// not recorded in the transaction, unlike ordinary function arguments.
+const (
+	consentTransientKey       = "consent"
+	encryptionKeyTransientKey = "encryptionKey"
+	userIDTransientKey        = "userId"
+)
+
+// encryptedUserIDPrefix marks a UserID stored in encrypted form.
+const encryptedUserIDPrefix = "enc:"
+
+// User IDs are encrypted with AES-256-GCM under a 32 byte key supplied by the caller. The nonce is an
+// HMAC-SHA256 of the user ID under the same key, so a user ID always encrypts to the same ciphertext
+// under a given key. That determinism is what lets every endorser produce identical writes and lets
+// GetConsentsByEncryptedUser find a user's consents with an equality query. The limitations follow
+// from it: records of the same user are linkable by anyone reading the ledger, endorsing peers see the
+// key and the plain user ID while executing, keys are managed off-chain and a lost key makes the IDs
+// unrecoverable, and the read functions must only be evaluated, never submitted, since a submitted
+// response would be written to the block in the clear.
+
+// CreateEncryptedConsent issues a new consent whose UserID is stored encrypted. The consent JSON, with
+// a plain userId, is read from the "consent" transient field and the key from "encryptionKey". It
+// holds the fields CreateConsent takes and is validated the same way; the duplicate check compares
+// encrypted user IDs. A ConsentCreated event is emitted.
+func (s *SmartContract) CreateEncryptedConsent(ctx contractapi.TransactionContextInterface) error {
+	key, err := transientEncryptionKey(ctx)
+	if err != nil {
+		return err
+	}
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to read transient data: %v", err)
+	}
+	consentJSON, ok := transient[consentTransientKey]
+	if !ok {
+		return fmt.Errorf("the %s transient field is required", consentTransientKey)
+	}
+
+	var input consentInput
+	err = decodeStrict(string(consentJSON), &input)
+	if err != nil {
+		return fmt.Errorf("failed to parse consent: %v", err)
+	}
+	if input.ID == "" || input.UserID == "" {
+		return fmt.Errorf("the consent id and userId must not be empty")
+	}
+	exists, err := s.ConsentExists(ctx, input.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the consent %s already exists", input.ID)
+	}
+
+	input.UserID, err = encryptUserID(key, input.UserID)
+	if err != nil {
+		return err
+	}
+	consent, err := s.newConsent(ctx, &input)
+	if err != nil {
+		return err
+	}
+	err = putConsent(ctx, consent)
+	if err != nil {
+		return err
+	}
+
+	return emitConsentCreated(ctx, consent)
+}
+
+// ReadEncryptedConsent returns the consent with its UserID decrypted using the "encryptionKey"
+// transient field.
+func (s *SmartContract) ReadEncryptedConsent(ctx contractapi.TransactionContextInterface, id string) (*Consent, error) {
+	key, err := transientEncryptionKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	consent.UserID, err = decryptUserID(key, consent.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt userId of consent %s: %v", id, err)
+	}
+
+	return consent, nil
+}
+
+// GetConsentsByEncryptedUser returns the consents of the user named in the "userId" transient
+// field, whose UserID was encrypted under the "encryptionKey" transient field.
+func (s *SmartContract) GetConsentsByEncryptedUser(ctx contractapi.TransactionContextInterface) ([]*Consent, error) {
+	key, err := transientEncryptionKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	userId := string(transient[userIDTransientKey])
+	if userId == "" {
+		return nil, fmt.Errorf("the %s transient field is required", userIDTransientKey)
+	}
+
+	encryptedUserID, err := encryptUserID(key, userId)
+	if err != nil {
+		return nil, err
+	}
+	consents, err := s.GetConsentsByUser(ctx, encryptedUserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, consent := range consents {
+		consent.UserID = userId
+	}
+
+	return consents, nil
+}
+
+// privateConsentCollection is the private data collection holding the private details of consents
+// created by CreateConsentPrivate. It must be defined in the collection config the chaincode is
+// approved with, see collections_config.json.
+const privateConsentCollection = "consentPrivateDetails"
+
+// ConsentPrivateDetails is the part of a consent kept in privateConsentCollection. Salt is an
+// optional random value chosen by the client so the public hash cannot be reversed by guessing the
+// user ID and purpose.
+type ConsentPrivateDetails struct {
+	ID      string `json:"id"`
+	UserID  string `json:"userId"`
+	Purpose string `json:"purpose"`
+	Salt    string `json:"salt,omitempty" metadata:",optional"`
+}
+
+// CreateConsentPrivate issues a new consent whose UserID and Purpose are stored in the private data
+// collection, leaving the public record with only their hash. The consent JSON, with an optional
+// salt field, is read from the "consent" transient field, so the private values never appear in
+// the transaction. Besides the salt it holds the fields CreateConsent takes and is validated the
+// same way.
+func (s *SmartContract) CreateConsentPrivate(ctx contractapi.TransactionContextInterface) error {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to read transient data: %v", err)
+	}
+	consentJSON, ok := transient[consentTransientKey]
+	if !ok {
+		return fmt.Errorf("the %s transient field is required", consentTransientKey)
+	}
+
+	var input struct {
+		consentInput
+		Salt string `json:"salt"`
+	}
+	err = decodeStrict(string(consentJSON), &input)
+	if err != nil {
+		return fmt.Errorf("failed to parse consent: %v", err)
+	}
+	if input.ID == "" || input.UserID == "" {
+		return fmt.Errorf("the consent id and userId must not be empty")
+	}
+	exists, err := s.ConsentExists(ctx, input.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the consent %s already exists", input.ID)
+	}
+	consent, err := s.newConsent(ctx, &input.consentInput)
+	if err != nil {
+		return err
+	}
+
+	details := ConsentPrivateDetails{ID: consent.ID, UserID: consent.UserID, Purpose: consent.Purpose, Salt: input.Salt}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutPrivateData(privateConsentCollection, consent.ID, detailsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put private data: %v", err)
+	}
+
+	consent.UserID = ""
+	consent.Purpose = ""
+	consent.PrivateDataHash = privateDataHash(detailsJSON)
+	err = putConsent(ctx, consent)
+	if err != nil {
+		return err
+	}
+
+	return emitConsentCreated(ctx, consent)
+}
+
+// ReadConsentPrivate returns the consent with its UserID and Purpose filled in from the private data
+// collection. It only succeeds on peers of organizations that are members of the collection.
+func (s *SmartContract) ReadConsentPrivate(ctx contractapi.TransactionContextInterface, id string) (*Consent, error) {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	details, _, err := readConsentPrivateDetails(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	consent.UserID = details.UserID
+	consent.Purpose = details.Purpose
+	return consent, nil
+}
+
+// VerifyConsentHash recomputes the hash of the consent's private details and reports whether it
+// matches the one recorded in its public record.
+func (s *SmartContract) VerifyConsentHash(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if consent.PrivateDataHash == "" {
+		return false, fmt.Errorf("the consent %s has no private data", id)
+	}
+	_, detailsJSON, err := readConsentPrivateDetails(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	return privateDataHash(detailsJSON) == consent.PrivateDataHash, nil
+}
+
+// readConsentPrivateDetails reads the private details of a consent along with their raw bytes.
+func readConsentPrivateDetails(ctx contractapi.TransactionContextInterface, id string) (*ConsentPrivateDetails, []byte, error) {
+	detailsJSON, err := ctx.GetStub().GetPrivateData(privateConsentCollection, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read private data: %v", err)
+	}
+	if detailsJSON == nil {
+		return nil, nil, fmt.Errorf("the consent %s has no private details", id)
+	}
+
+	var details ConsentPrivateDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &details, detailsJSON, nil
+}
+
+// privateDataHash returns the hex SHA-256 of the stored private details.
+func privateDataHash(detailsJSON []byte) string {
+	hash := sha256.Sum256(detailsJSON)
+	return hex.EncodeToString(hash[:])
+}
+
+// transientEncryptionKey reads the AES-256 key from the transient map.
+func transientEncryptionKey(ctx contractapi.TransactionContextInterface) ([]byte, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	key, ok := transient[encryptionKeyTransientKey]
+	if !ok {
+		return nil, fmt.Errorf("the %s transient field is required", encryptionKeyTransientKey)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("the %s transient field must be a 32 byte AES-256 key, got %d bytes", encryptionKeyTransientKey, len(key))
+	}
+
+	return key, nil
+}
+
+// encryptUserID deterministically encrypts userId under key.
+func encryptUserID(key []byte, userId string) (string, error) {
+	aead, err := newUserIDCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(userId))
+	nonce := mac.Sum(nil)[:aead.NonceSize()]
+
+	sealed := aead.Seal(nonce, nonce, []byte(userId), nil)
+	return encryptedUserIDPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptUserID reverses encryptUserID.
+func decryptUserID(key []byte, stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedUserIDPrefix) {
+		return "", fmt.Errorf("the userId is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedUserIDPrefix))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newUserIDCipher(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("the encrypted userId is truncated")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	userId, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(userId), nil
+}
+
+// newUserIDCipher returns the AES-GCM cipher used for user IDs.
+func newUserIDCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// WriteReceipt tells the client where a write landed: the transaction ID to correlate with block
+// events and the transaction timestamp in RFC 3339 form.
+type WriteReceipt struct {
+	ConsentID string `json:"consentId"`
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+}
+
+// CreateConsentWithReceipt is CreateConsent returning a WriteReceipt for the new consent.
+func (s *SmartContract) CreateConsentWithReceipt(ctx contractapi.TransactionContextInterface, id string, userId string, service string, provider string, consentGiven bool, timestamp string, expirationDate string, purpose string, collectionMethod string, termsVersion string, ageVerified bool, forceCreate bool) (*WriteReceipt, error) {
+	err := s.CreateConsent(ctx, id, userId, service, provider, consentGiven, timestamp, expirationDate, purpose, collectionMethod, termsVersion, ageVerified, forceCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWriteReceipt(ctx, id)
+}
+
+// UpdateConsentWithReceipt is UpdateConsent returning a WriteReceipt for the updated consent.
+func (s *SmartContract) UpdateConsentWithReceipt(ctx contractapi.TransactionContextInterface, id string, userId string, service string, provider string, consentGiven bool, timestamp string, expirationDate string, purpose string) (*WriteReceipt, error) {
+	err := s.UpdateConsent(ctx, id, userId, service, provider, consentGiven, timestamp, expirationDate, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWriteReceipt(ctx, id)
+}
+
+// newWriteReceipt returns the receipt of the current transaction's write of the given consent.
+func newWriteReceipt(ctx contractapi.TransactionContextInterface, id string) (*WriteReceipt, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WriteReceipt{ConsentID: id, TxID: ctx.GetStub().GetTxID(), Timestamp: now.UTC().Format(time.RFC3339)}, nil
+}
+
+// revocationReceipt is the proof of withdrawal handed to a user. Hash is the hex SHA-256 of the
+// JSON encoding of the receipt with Hash left empty.
+type revocationReceipt struct {
+	ConsentID string `json:"consentId"`
+	UserID    string `json:"userId"`
+	Provider  string `json:"provider"`
+	RevokedAt string `json:"revokedAt"`
+	Reason    string `json:"reason"`
+	TxID      string `json:"txId"`
+	Hash      string `json:"hash,omitempty"`
+}
+
+// GenerateRevocationReceipt returns a JSON receipt for a revoked consent that the user can retain as
+// proof of withdrawal. The receipt only depends on the stored consent, so generating it again yields
+// the same document and hash. The caller must be the user or an admin for the consent's provider.
+func (s *SmartContract) GenerateRevocationReceipt(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	err = assertUserOrProviderAdmin(ctx, consent)
+	if err != nil {
+		return "", err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	if consentStatus(consent, now) != statusRevoked {
+		return "", fmt.Errorf("the consent %s has not been revoked", id)
+	}
+	if consent.RevocationTxID == "" {
+		return "", fmt.Errorf("the consent %s was revoked before revocation transactions were recorded", id)
+	}
+
+	receipt := revocationReceipt{
+		ConsentID: consent.ID,
+		UserID:    consent.UserID,
+		Provider:  consent.Provider,
+		RevokedAt: consent.RevokedAt,
+		Reason:    consent.RevocationReason,
+		TxID:      consent.RevocationTxID,
+	}
+	contents, err := json.Marshal(receipt)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(contents)
+	receipt.Hash = hex.EncodeToString(hash[:])
+
+	receiptJSON, err := json.Marshal(receipt)
+	if err != nil {
+		return "", err
+	}
+
+	return string(receiptJSON), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// reminderCooldown is how long after a reminder a consent is not reminded again.
+const reminderCooldown = 7 * 24 * time.Hour
+
+// MarkReminderSent records that an expiry reminder was sent for the consent at the transaction
+// time, so that restarted notifiers do not send it again during the cooldown.
+func (s *SmartContract) MarkReminderSent(ctx contractapi.TransactionContextInterface, id string) error {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = assertProviderAdmin(ctx, consent.Provider)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	consent.ReminderSentAt = now.UTC().Format(time.RFC3339)
+	return putConsent(ctx, consent)
+}
+
+// GetConsentsNeedingReminder returns active consents due for an expiry reminder that have not been
+// reminded during the last reminderCooldown. A consent is due when it expires within its provider's
+// reminder lead days of the transaction timestamp, or within withinDays when no lead time has been
+// set for the provider.
+func (s *SmartContract) GetConsentsNeedingReminder(ctx contractapi.TransactionContextInterface, withinDays int) ([]*Consent, error) {
+	consents, err := s.GetConsentsExpiringWithin(ctx, withinDays, true)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	due := []*Consent{}
+	for _, consent := range consents {
+		if !recentlyReminded(consent, now) {
+			due = append(due, consent)
+		}
+	}
+
+	return due, nil
+}
+
+// GetConsentsExpiringWithin returns active consents expiring within days of the transaction
+// timestamp. In per-provider mode a provider's configured reminder lead days take precedence over
+// days, which then only applies to providers without a lead time of their own.
+func (s *SmartContract) GetConsentsExpiringWithin(ctx contractapi.TransactionContextInterface, days int, perProvider bool) ([]*Consent, error) {
+	if days < 0 {
+		return nil, fmt.Errorf("days must not be negative, got %d", days)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	leadDays := make(map[string]int)
+	if perProvider {
+		leadDays, err = s.GetReminderLeadDays(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	consents := []*Consent{}
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		if !isActive(consent, now) {
+			return nil
+		}
+		within, ok := leadDays[consent.Provider]
+		if !ok {
+			within = days
+		}
+		expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+		if err != nil || expiration.After(now.AddDate(0, 0, within)) {
+			return nil
+		}
+		consents = append(consents, consent)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return consents, nil
+}
+
+// GetActiveConsentsExpiringWithin returns the granted, unexpired consents expiring within days of
+// the transaction timestamp, the target list of a renewal campaign.
+func (s *SmartContract) GetActiveConsentsExpiringWithin(ctx contractapi.TransactionContextInterface, days int) ([]*Consent, error) {
+	return s.GetConsentsExpiringWithin(ctx, days, false)
+}
+
+// recentlyReminded returns true when a reminder was sent within the cooldown before now.
+func recentlyReminded(consent *Consent, now time.Time) bool {
+	if consent.ReminderSentAt == "" {
+		return false
+	}
+	sentAt, err := parseConsentDate("reminderSentAt", consent.ReminderSentAt)
+	if err != nil {
+		return false
+	}
+
+	return now.Sub(sentAt) < reminderCooldown
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// consentMetrics is the payload of the ConsentMetrics event.
+type consentMetrics struct {
+	Active  int    `json:"active"`
+	Revoked int    `json:"revoked"`
+	Expired int    `json:"expired"`
+	Total   int    `json:"total"`
+	AsOf    string `json:"asOf"`
+}
+
+// EmitConsentMetrics counts active, revoked and expired consents in a single pass over the world
+// state and publishes the totals as a ConsentMetrics event for off-chain collectors.
+func (s *SmartContract) EmitConsentMetrics(ctx contractapi.TransactionContextInterface) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	metrics := consentMetrics{AsOf: now.UTC().Format(time.RFC3339)}
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		switch consentStatus(consent, now) {
+		case statusActive:
+			metrics.Active++
+		case statusRevoked:
+			metrics.Revoked++
+		case statusExpired:
+			metrics.Expired++
+		}
+		metrics.Total++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, "ConsentMetrics", metrics)
+}
+
+// CountConsents returns the number of consents in the world state without deserializing them.
+func (s *SmartContract) CountConsents(ctx contractapi.TransactionContextInterface) (int, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	count := 0
+	for resultsIterator.HasNext() {
+		_, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// CountConsentsByProvider returns the number of consents for a specific provider. The query asks
+// CouchDB for no document fields, so only keys are transferred.
+func (s *SmartContract) CountConsentsByProvider(ctx contractapi.TransactionContextInterface, provider string) (int, error) {
+	provider, err := normalizeProvider(provider)
+	if err != nil {
+		return 0, err
+	}
+	queryString := fmt.Sprintf(`{"selector":{"provider":"%s"},"fields":["id"]}`, provider)
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	count := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		if isLiveConsentKey(queryResponse.Key) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// ProviderSummary counts the consents of a provider by status. Total also includes consents that are
+// pending or opted out.
+type ProviderSummary struct {
+	Total   int `json:"total"`
+	Active  int `json:"active"`
+	Revoked int `json:"revoked"`
+	Expired int `json:"expired"`
+}
+
+// GetConsentSummaryByProvider counts the active, revoked and expired consents of every provider in
+// a single pass over the world state, evaluating statuses at the transaction timestamp.
+func (s *SmartContract) GetConsentSummaryByProvider(ctx contractapi.TransactionContextInterface) (map[string]ProviderSummary, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make(map[string]ProviderSummary)
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		summary := summaries[consent.Provider]
+		summary.Total++
+		switch consentStatus(consent, now) {
+		case statusActive:
+			summary.Active++
+		case statusRevoked:
+			summary.Revoked++
+		case statusExpired:
+			summary.Expired++
+		}
+		summaries[consent.Provider] = summary
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+// ProviderScorecard summarizes the consents of a provider. ActiveRate is Active divided by Total,
+// and AverageLifetimeDays the mean time from creation to revocation or expiry over the consents
+// that have ended
+type ProviderScorecard struct {
+	Provider            string  `json:"provider"`
+	Total               int     `json:"total"`
+	Active              int     `json:"active"`
+	Revoked             int     `json:"revoked"`
+	Expired             int     `json:"expired"`
+	ActiveRate          float64 `json:"activeRate"`
+	AverageLifetimeDays float64 `json:"averageLifetimeDays"`
+}
+
+// GetProviderScorecard computes the scorecard of a provider in a single pass over its consents,
+// evaluating statuses at the transaction timestamp. Consents whose creation timestamp or end date
+// cannot be parsed are left out of the average lifetime.
+func (s *SmartContract) GetProviderScorecard(ctx contractapi.TransactionContextInterface, provider string) (*ProviderScorecard, error) {
+	consents, err := s.GetConsentsByProvider(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scorecard := &ProviderScorecard{Provider: provider}
+	var lifetime time.Duration
+	ended := 0
+	for _, consent := range consents {
+		scorecard.Total++
+		var end string
+		switch consentStatus(consent, now) {
+		case statusActive:
+			scorecard.Active++
+		case statusRevoked:
+			scorecard.Revoked++
+			end = consent.RevokedAt
+		case statusExpired:
+			scorecard.Expired++
+			end = consent.ExpirationDate
+		}
+		if end == "" {
+			continue
+		}
+
+		created, err := parseConsentDate("timestamp", consent.Timestamp)
+		if err != nil {
+			continue
+		}
+		endedAt, err := parseConsentDate("end", end)
+		if err != nil {
+			continue
+		}
+		lifetime += endedAt.Sub(created)
+		ended++
+	}
+
+	if scorecard.Total > 0 {
+		scorecard.ActiveRate = float64(scorecard.Active) / float64(scorecard.Total)
+	}
+	if ended > 0 {
+		scorecard.AverageLifetimeDays = lifetime.Hours() / 24 / float64(ended)
+	}
+
+	return scorecard, nil
+}
+
+// GetMultiProviderUsers returns, for each user holding active consents for the service with more
+// than one provider, the sorted list of those providers. Users with a single provider are left out.
+func (s *SmartContract) GetMultiProviderUsers(ctx contractapi.TransactionContextInterface, service string) (map[string][]string, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	queryString := fmt.Sprintf(`{"selector":{"service":"%s"}}`, service)
+	consents, err := getQueryResultForQueryString(ctx, queryString)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := make(map[string][]string)
+	for _, consent := range consents {
+		if !isActive(consent, now) || contains(providers[consent.UserID], consent.Provider) {
+			continue
+		}
+		providers[consent.UserID] = append(providers[consent.UserID], consent.Provider)
+	}
+
+	users := make(map[string][]string)
+	for userId, userProviders := range providers {
+		if len(userProviders) > 1 {
+			sort.Strings(userProviders)
+			users[userId] = userProviders
+		}
+	}
+
+	return users, nil
+}
+
+// GetExpiryBucketsAllProviders groups active consents by provider and by how soon they expire, in a
+// single pass over the world state. Bucket n holds consents expiring in [n*bucketDays, (n+1)*bucketDays)
+// days from the transaction timestamp. Bucket indexes are returned as strings because contract
+// functions may only return maps keyed by string.
+func (s *SmartContract) GetExpiryBucketsAllProviders(ctx contractapi.TransactionContextInterface, bucketDays int) (map[string]map[string]int, error) {
+	if bucketDays <= 0 {
+		return nil, fmt.Errorf("bucketDays must be positive, got %d", bucketDays)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make(map[string]map[string]int)
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		if !isActive(consent, now) {
+			return nil
+		}
+		expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+		if err != nil {
+			return nil
+		}
+
+		if buckets[consent.Provider] == nil {
+			buckets[consent.Provider] = make(map[string]int)
+		}
+		bucket := strconv.Itoa(daysUntil(expiration, now) / bucketDays)
+		buckets[consent.Provider][bucket]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buckets, nil
+}
+
+// GetCreationHourHistogram counts consents by the UTC hour of day (0-23) of their creation
+// timestamp. Consents whose timestamp carries no time of day, or cannot be parsed, are counted under
+// "unknown". Hours are returned as strings because contract functions may only return maps keyed by
+// string.
+func (s *SmartContract) GetCreationHourHistogram(ctx contractapi.TransactionContextInterface) (map[string]int, error) {
+	histogram := make(map[string]int)
+	err := forEachConsent(ctx, func(consent *Consent) error {
+		if isDateOnly(consent.Timestamp) {
+			histogram["unknown"]++
+			return nil
+		}
+		created, err := parseConsentDate("timestamp", consent.Timestamp)
+		if err != nil {
+			histogram["unknown"]++
+			return nil
+		}
+
+		histogram[strconv.Itoa(created.UTC().Hour())]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return histogram, nil
+}
+
+// GetUnverifiedAgeConsents returns the consents for age-restricted services whose user's age has
+// not been verified, including those created before the service was restricted.
+func (s *SmartContract) GetUnverifiedAgeConsents(ctx contractapi.TransactionContextInterface) ([]*Consent, error) {
+	restricted, err := s.GetAgeRestrictedServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	consents := []*Consent{}
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		if contains(restricted, consent.Service) && !consent.AgeVerified {
+			consents = append(consents, consent)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return consents, nil
+}
+
+// pivotDimensions are the fields GetConsentPivot can group by, mapped to how to read them.
+var pivotDimensions = map[string]func(consent *Consent, now time.Time) string{
+	"provider":         func(c *Consent, now time.Time) string { return c.Provider },
+	"service":          func(c *Consent, now time.Time) string { return c.Service },
+	"purpose":          func(c *Consent, now time.Time) string { return c.Purpose },
+	"status":           consentStatus,
+	"collectionMethod": func(c *Consent, now time.Time) string { return c.CollectionMethod },
+	"termsVersion":     func(c *Consent, now time.Time) string { return c.TermsVersion },
+}
+
+// GetConsentPivot counts consents by two dimensions in a single pass, returning counts keyed by the
+// value of rowField and then of colField. Status is the effective status at the transaction
+// timestamp.
+func (s *SmartContract) GetConsentPivot(ctx contractapi.TransactionContextInterface, rowField string, colField string) (map[string]map[string]int, error) {
+	row, ok := pivotDimensions[rowField]
+	if !ok {
+		return nil, fmt.Errorf("unsupported pivot field %q", rowField)
+	}
+	col, ok := pivotDimensions[colField]
+	if !ok {
+		return nil, fmt.Errorf("unsupported pivot field %q", colField)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pivot := make(map[string]map[string]int)
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		r := row(consent, now)
+		if pivot[r] == nil {
+			pivot[r] = make(map[string]int)
+		}
+		pivot[r][col(consent, now)]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pivot, nil
+}
+
+// GetAllConsentsETag returns a deterministic hash over every consent ID and version, where a
+// version is the SHA-256 of the stored record. Clients can compare it with a previous value to
+// tell whether anything changed before fetching the full list with GetAllConsents.
+func (s *SmartContract) GetAllConsentsETag(ctx contractapi.TransactionContextInterface) (string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return "", err
+	}
+	defer resultsIterator.Close()
+
+	// range queries return keys in sorted order, so the (id, version) pairs are already ordered
+	etag := sha256.New()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return "", err
+		}
+		version := sha256.Sum256(queryResponse.Value)
+		etag.Write([]byte(queryResponse.Key))
+		etag.Write([]byte{0x00})
+		etag.Write(version[:])
+	}
+
+	return hex.EncodeToString(etag.Sum(nil)), nil
+}
+
+// UserConsentSummary counts a user's consents by effective status
+type UserConsentSummary struct {
+	UserID         string `json:"userId"`
+	Active         int    `json:"active"`
+	Revoked        int    `json:"revoked"`
+	Expired        int    `json:"expired"`
+	Pending        int    `json:"pending"`
+	NextExpiration string `json:"nextExpiration,omitempty" metadata:",optional"`
+}
+
+// GetUserConsentSummary returns how many of the user's consents are active, revoked, expired and
+// pending, plus the soonest upcoming expiration among the active ones.
+func (s *SmartContract) GetUserConsentSummary(ctx contractapi.TransactionContextInterface, userId string) (*UserConsentSummary, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	consents, err := s.GetConsentsByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &UserConsentSummary{UserID: userId}
+	var nextExpiration time.Time
+	for _, consent := range consents {
+		switch consentStatus(consent, now) {
+		case statusActive:
+			summary.Active++
+			expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+			if err == nil && (summary.NextExpiration == "" || expiration.Before(nextExpiration)) {
+				nextExpiration = expiration
+				summary.NextExpiration = consent.ExpirationDate
+			}
+		case statusRevoked:
+			summary.Revoked++
+		case statusExpired:
+			summary.Expired++
+		case statusPending:
+			summary.Pending++
+		}
+	}
+
+	return summary, nil
+}
+
+// SampleConsents returns a reproducible sample of n consents. Consents are ordered by the SHA-256 of
+// seed and ID, so every peer, and every later call with the same seed, selects the same sample.
+// n is capped at the number of consents.
+func (s *SmartContract) SampleConsents(ctx contractapi.TransactionContextInterface, n int, seed string) ([]*Consent, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("n must be positive, got %d", n)
+	}
+	consents, err := s.GetAllConsents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ranks := make(map[string]string, len(consents))
+	for _, consent := range consents {
+		rank := sha256.Sum256([]byte(seed + "\x00" + consent.ID))
+		ranks[consent.ID] = hex.EncodeToString(rank[:])
+	}
+	sort.Slice(consents, func(i, j int) bool {
+		return ranks[consents[i].ID] < ranks[consents[j].ID]
+	})
+
+	if n > len(consents) {
+		n = len(consents)
+	}
+
+	return consents[:n], nil
+}
+
+// cohortExport is the document returned by ExportCohort.
+type cohortExport struct {
+	StartDate  string         `json:"startDate"`
+	EndDate    string         `json:"endDate"`
+	AsOf       string         `json:"asOf"`
+	Total      int            `json:"total"`
+	ByProvider map[string]int `json:"byProvider"`
+	ByStatus   map[string]int `json:"byStatus"`
+	Consents   []*Consent     `json:"consents"`
+}
+
+// ExportCohort returns a JSON document with every consent created within [startDate, endDate],
+// ordered by ID, together with counts by provider and by status evaluated at the transaction
+// timestamp. Consents with an unparseable creation timestamp are left out.
+func (s *SmartContract) ExportCohort(ctx contractapi.TransactionContextInterface, startDate string, endDate string) (string, error) {
+	start, end, err := parseDateRange(startDate, endDate)
+	if err != nil {
+		return "", err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	export := cohortExport{
+		StartDate:  startDate,
+		EndDate:    endDate,
+		AsOf:       now.UTC().Format(time.RFC3339),
+		ByProvider: make(map[string]int),
+		ByStatus:   make(map[string]int),
+		Consents:   []*Consent{},
+	}
+	// range queries return keys in sorted order, so consents are collected ordered by ID
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		created, err := parseConsentDate("timestamp", consent.Timestamp)
+		if err != nil || created.Before(start) || created.After(end) {
+			return nil
+		}
+		export.ByProvider[consent.Provider]++
+		export.ByStatus[consentStatus(consent, now)]++
+		export.Consents = append(export.Consents, consent)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	export.Total = len(export.Consents)
+
+	exportJSON, err := json.Marshal(export)
+	if err != nil {
+		return "", err
+	}
+
+	return string(exportJSON), nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ConsentGovernance is a consent together with its governance review schedule. NextReviewDate is
+// empty when no review interval is configured for the consent's purpose
+type ConsentGovernance struct {
+	Consent        Consent `json:"consent"`
+	NextReviewDate string  `json:"nextReviewDate,omitempty" metadata:",optional"`
+	Overdue        bool    `json:"overdue"`
+}
+
+// ReadConsentGovernance returns the consent with the date it is next due for review, which is its
+// creation timestamp plus the review interval of its purpose, and whether that date has passed at
+// the transaction timestamp.
+func (s *SmartContract) ReadConsentGovernance(ctx contractapi.TransactionContextInterface, id string) (*ConsentGovernance, error) {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	intervals, err := s.GetReviewIntervalDays(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	governance := &ConsentGovernance{Consent: *consent}
+	next, ok := nextReviewDate(consent, intervals)
+	if ok {
+		governance.NextReviewDate = next.UTC().Format(time.RFC3339)
+		governance.Overdue = now.After(next)
+	}
+
+	return governance, nil
+}
+
+// GetOverdueReviewConsents returns the given consents whose review date has passed at the
+// transaction timestamp.
+func (s *SmartContract) GetOverdueReviewConsents(ctx contractapi.TransactionContextInterface) ([]*Consent, error) {
+	intervals, err := s.GetReviewIntervalDays(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	consents := []*Consent{}
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		if !consent.ConsentGiven {
+			return nil
+		}
+		next, ok := nextReviewDate(consent, intervals)
+		if ok && now.After(next) {
+			consents = append(consents, consent)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return consents, nil
+}
+
+// nextReviewDate returns the review date of a consent, or false when its purpose has no
+// review interval or its creation timestamp cannot be parsed.
+func nextReviewDate(consent *Consent, intervals map[string]int) (time.Time, bool) {
+	days, ok := intervals[consent.Purpose]
+	if !ok {
+		return time.Time{}, false
+	}
+	created, err := parseConsentDate("timestamp", consent.Timestamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return created.AddDate(0, 0, days), true
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// AddScope extends a consent to cover another service of its provider. Adding a scope the consent
+// already covers is a no-op. The caller must belong to the organization that created the consent
+// and be an admin for its provider.
+func (s *SmartContract) AddScope(ctx contractapi.TransactionContextInterface, id string, scope string) error {
+	if scope == "" {
+		return fmt.Errorf("the scope must not be empty")
+	}
+	consent, err := s.readConsentForChange(ctx, id)
+	if err != nil {
+		return err
+	}
+	if coversScope(consent, scope) {
+		return nil
+	}
+	err = validateServiceForProvider(ctx, scope, consent.Provider)
+	if err != nil {
+		return err
+	}
+
+	consent.Scopes = append(consent.Scopes, scope)
+	return putConsent(ctx, consent)
+}
+
+// RemoveScope withdraws a scope added by AddScope. Removing a scope the consent does not have is a
+// no-op; the consent's Service cannot be removed this way. The caller must belong to the
+// organization that created the consent and be an admin for its provider.
+func (s *SmartContract) RemoveScope(ctx contractapi.TransactionContextInterface, id string, scope string) error {
+	if scope == "" {
+		return fmt.Errorf("the scope must not be empty")
+	}
+	consent, err := s.readConsentForChange(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	scopes := []string{}
+	for _, existing := range consent.Scopes {
+		if existing != scope {
+			scopes = append(scopes, existing)
+		}
+	}
+	if len(scopes) == len(consent.Scopes) {
+		return nil
+	}
+
+	consent.Scopes = scopes
+	return putConsent(ctx, consent)
+}
+
+// ConsentCoversScope reports whether the consent is active at the transaction timestamp and covers
+// the given scope, either as its Service or as one of its Scopes.
+func (s *SmartContract) ConsentCoversScope(ctx contractapi.TransactionContextInterface, id string, scope string) (bool, error) {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return coversScope(consent, scope) && isActive(consent, now), nil
+}
+
+// readConsentForChange reads a consent the caller is about to change, checking that they belong to
+// the organization that created it and are an admin for its provider.
+func (s *SmartContract) readConsentForChange(ctx contractapi.TransactionContextInterface, id string) (*Consent, error) {
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = assertOwnerMSP(ctx, consent)
+	if err != nil {
+		return nil, err
+	}
+	err = assertProviderAdmin(ctx, consent.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return consent, nil
+}
+
+// coversScope reports whether the scope is the consent's Service or one of its Scopes.
+func coversScope(consent *Consent, scope string) bool {
+	return consent.Service == scope || contains(consent.Scopes, scope)
+}
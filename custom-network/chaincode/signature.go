@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// userKeyObjectType is the composite key namespace under which user verification keys are stored.
+// Composite keys are not returned by GetStateByRange, so keys never show up in GetAllConsents.
+const userKeyObjectType = "userKey"
+
+// CreateSignedConsent issues a new consent whose payload has been signed by the user it belongs to.
+// The signature must be the base64 encoding of a signature over the exact consentJSON bytes, made with
+// the private key matching the user's registered public key. ECDSA and RSA signatures are computed over
+// the SHA-256 digest of the payload, Ed25519 signatures over the payload itself. The payload holds
+// the fields CreateConsent takes, under their JSON names, and anything else is rejected; the
+// consent is validated as CreateConsent validates it. A ConsentCreated event is emitted.
+func (s *SmartContract) CreateSignedConsent(ctx contractapi.TransactionContextInterface, consentJSON string, signature string) error {
+	var input consentInput
+	err := decodeStrict(consentJSON, &input)
+	if err != nil {
+		return fmt.Errorf("failed to parse consent: %v", err)
+	}
+	if input.ID == "" {
+		return fmt.Errorf("the consent id must not be empty")
+	}
+
+	exists, err := s.ConsentExists(ctx, input.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the consent %s already exists", input.ID)
+	}
+
+	publicKey, err := getUserPublicKey(ctx, input.UserID)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %v", err)
+	}
+	err = verifySignature(publicKey, []byte(consentJSON), sig)
+	if err != nil {
+		return fmt.Errorf("signature verification failed for consent %s: %v", input.ID, err)
+	}
+
+	consent, err := s.newConsent(ctx, &input)
+	if err != nil {
+		return err
+	}
+	consent.Signature = signature
+
+	err = putConsent(ctx, consent)
+	if err != nil {
+		return err
+	}
+
+	return emitConsentCreated(ctx, consent)
+}
+
+// RegisterUserKey stores the PEM encoded public key (or certificate) used to verify consents signed
+// by the given user. Only the user themselves or an admin may set a user's key.
+func (s *SmartContract) RegisterUserKey(ctx contractapi.TransactionContextInterface, userId string, pubKeyPEM string) error {
+	if userId == "" {
+		return fmt.Errorf("the user id must not be empty")
+	}
+	err := assertUserOrAdmin(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = parsePublicKeyPEM(pubKeyPEM)
+	if err != nil {
+		return err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(userKeyObjectType, []string{userId})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, []byte(pubKeyPEM))
+}
+
+// GetUserKey returns the PEM encoded verification key registered for the given user.
+func (s *SmartContract) GetUserKey(ctx contractapi.TransactionContextInterface, userId string) (string, error) {
+	pubKeyPEM, err := getUserKeyPEM(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pubKeyPEM), nil
+}
+
+// getUserKeyPEM reads the raw PEM registered for the given user.
+func getUserKeyPEM(ctx contractapi.TransactionContextInterface, userId string) ([]byte, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(userKeyObjectType, []string{userId})
+	if err != nil {
+		return nil, err
+	}
+	pubKeyPEM, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if pubKeyPEM == nil {
+		return nil, fmt.Errorf("no public key registered for user %s", userId)
+	}
+
+	return pubKeyPEM, nil
+}
+
+// getUserPublicKey loads and parses the verification key registered for the given user.
+func getUserPublicKey(ctx contractapi.TransactionContextInterface, userId string) (crypto.PublicKey, error) {
+	pubKeyPEM, err := getUserKeyPEM(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePublicKeyPEM(string(pubKeyPEM))
+}
+
+// parsePublicKeyPEM decodes a PEM encoded PKIX public key or X.509 certificate and returns its
+// public key if it is of a supported type (ECDSA, RSA or Ed25519).
+func parsePublicKeyPEM(pubKeyPEM string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pubKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM public key")
+	}
+
+	var publicKey crypto.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %v", err)
+		}
+		publicKey = key
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		publicKey = cert.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	switch publicKey.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return publicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
+// verifySignature checks sig over payload with the given public key.
+func verifySignature(publicKey crypto.PublicKey, payload []byte, sig []byte) error {
+	digest := sha256.Sum256(payload)
+
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], sig) {
+			return fmt.Errorf("invalid ECDSA signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, payload, sig) {
+			return fmt.Errorf("invalid Ed25519 signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
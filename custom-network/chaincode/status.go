@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Effective consent statuses. They are derived from the stored fields and evaluated against
+// the transaction timestamp, so every endorser computes the same result.
+const (
+	statusPending  = "pending"
+	statusActive   = "active"
+	statusRevoked  = "revoked"
+	statusExpired  = "expired"
+	statusOptedOut = "opted-out"
+)
+
+// consentStatus evaluates the effective status of a consent at the given time. A consent that is not
+// given is revoked, or opted-out when the user explicitly refused it, unless SetConsentStatus put it
+// in the pending or expired status. A granted consent is active from its EffectiveFrom (immediately
+// when unset) up to and including its ExpirationDate. Consents whose expiration date cannot be
+// parsed are treated as expired, and those whose effective-from date cannot be parsed as pending.
+func consentStatus(consent *Consent, now time.Time) string {
+	if !consent.ConsentGiven {
+		if consent.OptedOut {
+			return statusOptedOut
+		}
+		if consent.Status == statusPending || consent.Status == statusExpired {
+			// set explicitly with SetConsentStatus
+			return consent.Status
+		}
+		return statusRevoked
+	}
+
+	expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+	if err != nil || now.After(expiration) {
+		return statusExpired
+	}
+
+	if consent.EffectiveFrom != "" {
+		effectiveFrom, err := parseConsentDate("effectiveFrom", consent.EffectiveFrom)
+		if err != nil || now.Before(effectiveFrom) {
+			return statusPending
+		}
+	}
+
+	return statusActive
+}
+
+// isActive returns true when the consent is in effect at the given time and has not used up its
+// allowed number of uses.
+func isActive(consent *Consent, now time.Time) bool {
+	return consentStatus(consent, now) == statusActive && !exhausted(consent)
+}
+
+// allowedTransitions is the consent state machine: the statuses each status may move to.
+// Staying in the same status is always allowed.
+var allowedTransitions = map[string][]string{
+	statusPending:  {statusActive, statusRevoked},
+	statusActive:   {statusRevoked, statusExpired},
+	statusExpired:  {statusActive, statusRevoked},
+	statusRevoked:  {statusActive},
+	statusOptedOut: {statusActive},
+}
+
+// canTransition returns true when a consent may move from one status to another.
+func canTransition(from string, to string) bool {
+	if from == to {
+		return true
+	}
+
+	return contains(allowedTransitions[from], to)
+}
+
+// assertTransition returns an error unless the consent may move from its current effective status
+// to the given one.
+func assertTransition(consent *Consent, to string, now time.Time) error {
+	from := consentStatus(consent, now)
+	if !canTransition(from, to) {
+		return fmt.Errorf("illegal status transition for consent %s: %s -> %s", consent.ID, from, to)
+	}
+
+	return nil
+}
+
+// SetConsentStatus moves a consent to the given status if the state machine allows it. Setting a
+// consent active sets ConsentGiven; setting it pending or expired clears it. A consent that is
+// pending only because its EffectiveFrom has not been reached keeps ConsentGiven true. Setting the
+// current status is a no-op. Setting a consent active fails when its dates would not make it
+// active at the transaction timestamp; use ExtendConsent or ReactivateConsent for expired
+// consents. The caller must belong to the organization that created the consent and be an admin
+// for its provider.
+func (s *SmartContract) SetConsentStatus(ctx contractapi.TransactionContextInterface, id string, status string) error {
+	if _, ok := allowedTransitions[status]; !ok {
+		return fmt.Errorf("unknown status %q", status)
+	}
+	consent, err := s.ReadConsent(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = assertOwnerMSP(ctx, consent)
+	if err != nil {
+		return err
+	}
+	err = assertProviderAdmin(ctx, consent.Provider)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if consentStatus(consent, now) == status {
+		return nil
+	}
+	err = assertTransition(consent, status, now)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case statusRevoked:
+		err = revokeConsent(consent, "", now)
+		if err != nil {
+			return err
+		}
+	case statusActive:
+		consent.ConsentGiven = true
+		consent.OptedOut = false
+		if evaluated := consentStatus(consent, now); evaluated != statusActive {
+			return fmt.Errorf("the consent %s cannot be set active: it would be %s", id, evaluated)
+		}
+	case statusPending, statusExpired:
+		consent.ConsentGiven = false
+		consent.OptedOut = false
+		consent.Status = status
+	default:
+		return fmt.Errorf("the status of consent %s cannot be set to %s", id, status)
+	}
+
+	err = putConsent(ctx, consent)
+	if err != nil {
+		return err
+	}
+
+	return emitConsentChanged(ctx, "ConsentUpdated", consent)
+}
+
+// GetAllowedTransitions returns the statuses a consent in the given status may move to.
+func (s *SmartContract) GetAllowedTransitions(ctx contractapi.TransactionContextInterface, status string) ([]string, error) {
+	next, ok := allowedTransitions[status]
+	if !ok {
+		return nil, fmt.Errorf("unknown status %q", status)
+	}
+
+	return next, nil
+}
+
+// consentsExpired is the payload of the ConsentExpired event.
+type consentsExpired struct {
+	ConsentIDs []string `json:"consentIds"`
+}
+
+// MaterializeStatuses recomputes the effective status of every consent against the transaction
+// timestamp and persists it in the Status field where it has changed, returning the number of
+// consents rewritten. Consents under legal hold keep their stored status. The IDs of consents that
+// became expired are reported in a single "ConsentExpired" event.
+func (s *SmartContract) MaterializeStatuses(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	expired := []string{}
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		status := consentStatus(consent, now)
+		if consent.Status == status || consent.Frozen {
+			return nil
+		}
+		if status == statusExpired {
+			expired = append(expired, consent.ID)
+		}
+
+		changed++
+		return putConsent(ctx, consent)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(expired) > 0 {
+		err = emitEvent(ctx, "ConsentExpired", consentsExpired{ConsentIDs: expired})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return changed, nil
+}
+
+// GetPendingConsentsOlderThan returns the pending consents submitted more than the given number of
+// hours before the transaction timestamp, i.e. those that have breached the approval SLA. The
+// submission time is the consent's Timestamp; consents whose timestamp cannot be parsed are skipped.
+func (s *SmartContract) GetPendingConsentsOlderThan(ctx contractapi.TransactionContextInterface, hours int) ([]*Consent, error) {
+	if hours < 0 {
+		return nil, fmt.Errorf("hours must not be negative, got %d", hours)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := now.Add(-time.Duration(hours) * time.Hour)
+
+	consents := []*Consent{}
+	err = forEachConsent(ctx, func(consent *Consent) error {
+		if consentStatus(consent, now) != statusPending {
+			return nil
+		}
+		submittedAt, err := parseConsentDate("timestamp", consent.Timestamp)
+		if err != nil || !submittedAt.Before(cutoff) {
+			return nil
+		}
+		consents = append(consents, consent)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return consents, nil
+}
+
+// consentsActivated is the payload of the ConsentActivated event.
+type consentsActivated struct {
+	ConsentIDs []string `json:"consentIds"`
+}
+
+// ActivateEffectiveConsents finds the consents stored as pending whose effective date has been
+// reached at the transaction timestamp, materializes their active status and returns how many were
+// activated. A single ConsentActivated event lists their IDs. Activated consents are no longer
+// stored as pending, so running the job again does not report them twice. Consents under legal
+// hold are left pending. Only admins may run it.
+func (s *SmartContract) ActivateEffectiveConsents(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := assertAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	queryString := fmt.Sprintf(`{"selector":{"status":"%s"}}`, statusPending)
+	consents, err := getQueryResultForQueryString(ctx, queryString)
+	if err != nil {
+		return 0, err
+	}
+
+	activated := consentsActivated{ConsentIDs: []string{}}
+	for _, consent := range consents {
+		if consent.Frozen || consentStatus(consent, now) != statusActive {
+			continue
+		}
+		err = putConsent(ctx, consent)
+		if err != nil {
+			return 0, err
+		}
+		activated.ConsentIDs = append(activated.ConsentIDs, consent.ID)
+	}
+
+	if len(activated.ConsentIDs) > 0 {
+		err = emitEvent(ctx, "ConsentActivated", activated)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(activated.ConsentIDs), nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// exhaustedReason is the revocation reason of consents that used up their allowed number of uses.
+const exhaustedReason = "uses-exhausted"
+
+// consentExhausted is the payload of the ConsentExhausted event.
+type consentExhausted struct {
+	ID       string `json:"id"`
+	UserID   string `json:"userId"`
+	MaxUses  int    `json:"maxUses"`
+	UseCount int    `json:"useCount"`
+}
+
+// SetConsentMaxUses limits how many times a consent may be used, 0 meaning unlimited. A granted
+// consent that has already been used maxUses times is revoked as exhausted, as RecordConsentUse
+// would. The caller must belong to the organization that created the consent and be an admin for
+// its provider.
+func (s *SmartContract) SetConsentMaxUses(ctx contractapi.TransactionContextInterface, id string, maxUses int) error {
+	if maxUses < 0 {
+		return fmt.Errorf("maxUses must not be negative, got %d", maxUses)
+	}
+	consent, err := s.readConsentForChange(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	consent.MaxUses = maxUses
+	if !consent.ConsentGiven || !exhausted(consent) {
+		return putConsent(ctx, consent)
+	}
+
+	return exhaustConsent(ctx, consent, now)
+}
+
+// RecordConsentUse counts one use of an active consent. When the use count reaches MaxUses the
+// consent is revoked and a ConsentExhausted event is emitted. The caller must belong to the
+// organization that created the consent and be an admin for its provider.
+func (s *SmartContract) RecordConsentUse(ctx contractapi.TransactionContextInterface, id string) error {
+	consent, err := s.readConsentForChange(ctx, id)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !isActive(consent, now) {
+		return fmt.Errorf("the consent %s is not active", id)
+	}
+
+	consent.UseCount++
+	if !exhausted(consent) {
+		return putConsent(ctx, consent)
+	}
+
+	return exhaustConsent(ctx, consent, now)
+}
+
+// exhaustConsent revokes a consent that used up its allowed number of uses and emits a
+// ConsentExhausted event.
+func exhaustConsent(ctx contractapi.TransactionContextInterface, consent *Consent, now time.Time) error {
+	err := revokeConsent(consent, exhaustedReason, now)
+	if err != nil {
+		return err
+	}
+	err = putConsent(ctx, consent)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, "ConsentExhausted", consentExhausted{
+		ID:       consent.ID,
+		UserID:   consent.UserID,
+		MaxUses:  consent.MaxUses,
+		UseCount: consent.UseCount,
+	})
+}
+
+// exhausted returns true when the consent has a use limit and has reached it.
+func exhausted(consent *Consent) bool {
+	return consent.MaxUses > 0 && consent.UseCount >= consent.MaxUses
+}
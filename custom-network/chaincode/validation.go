@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// allowPastExpirationTransientKey is the transient field an admin sets to "true" to create consents
+// that are already expired, for example when importing historical records. Passing it through the
+// transient map keeps the override out of the ordinary function arguments and the ledger.
+const allowPastExpirationTransientKey = "allowPastExpiration"
+
+// allowedProviders are the providers a consent may be given to.
+var allowedProviders = []string{"JIO", "Airtel"}
+
+// normalizeProvider trims surrounding whitespace from a provider and validates it.
+func normalizeProvider(provider string) (string, error) {
+	provider = strings.TrimSpace(provider)
+	err := validateProvider(provider)
+	if err != nil {
+		return "", err
+	}
+
+	return provider, nil
+}
+
+// validateProvider returns an error unless provider is one of allowedProviders.
+func validateProvider(provider string) error {
+	if !contains(allowedProviders, provider) {
+		return fmt.Errorf("invalid provider %q: must be one of %v", provider, allowedProviders)
+	}
+
+	return nil
+}
+
+// validateNewConsent checks the rules every newly written consent must satisfy, whichever
+// function creates it. It trims the provider, fills in a default expiration date when none was
+// given and stamps the current schema version, so new records skip the legacy migrations.
+func validateNewConsent(ctx contractapi.TransactionContextInterface, consent *Consent) error {
+	consent.SchemaVersion = currentSchemaVersion
+
+	provider, err := normalizeProvider(consent.Provider)
+	if err != nil {
+		return err
+	}
+	consent.Provider = provider
+
+	err = validateServiceForProvider(ctx, consent.Service, consent.Provider)
+	if err != nil {
+		return err
+	}
+
+	restricted, err := getConfigList(ctx, ageRestrictedServicesConfig, []string{})
+	if err != nil {
+		return err
+	}
+	if contains(restricted, consent.Service) && !consent.AgeVerified {
+		return fmt.Errorf("the service %s is age-restricted: the consent %s requires ageVerified", consent.Service, consent.ID)
+	}
+
+	methods, err := getConfigList(ctx, collectionMethodsConfig, defaultCollectionMethods)
+	if err != nil {
+		return err
+	}
+	if consent.CollectionMethod == "" {
+		return fmt.Errorf("the consent %s has no collectionMethod", consent.ID)
+	}
+	if !contains(methods, consent.CollectionMethod) {
+		return fmt.Errorf("invalid collectionMethod %q: must be one of %v", consent.CollectionMethod, methods)
+	}
+
+	termsVersions, err := getConfigList(ctx, termsVersionsConfig, defaultTermsVersions)
+	if err != nil {
+		return err
+	}
+	if consent.TermsVersion == "" {
+		return fmt.Errorf("the consent %s has no termsVersion", consent.ID)
+	}
+	if !contains(termsVersions, consent.TermsVersion) {
+		return fmt.Errorf("invalid termsVersion %q: must be one of %v", consent.TermsVersion, termsVersions)
+	}
+
+	if consent.MaxUses < 0 {
+		return fmt.Errorf("maxUses must not be negative, got %d", consent.MaxUses)
+	}
+
+	if consent.RetentionCategory != "" {
+		err = validateRetentionCategory(ctx, consent.RetentionCategory)
+		if err != nil {
+			return err
+		}
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	if consent.ExpirationDate == "" {
+		consent.ExpirationDate, err = defaultExpirationDate(ctx, consent, now)
+		if err != nil {
+			return err
+		}
+	}
+	err = applyRegionExpiryCap(ctx, consent, now)
+	if err != nil {
+		return err
+	}
+	err = validateConsentDates(consent)
+	if err != nil {
+		return err
+	}
+	expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+	if err != nil {
+		return err
+	}
+	if !expiration.After(now) {
+		allowed, err := pastExpirationAllowed(ctx)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf("the consent %s would be born expired: expirationDate %s is not after the transaction time", consent.ID, consent.ExpirationDate)
+		}
+	}
+
+	return nil
+}
+
+// applyRegionExpiryCap enforces the expiry policy of the consent's region: an expiration later than
+// the region's maximum validity from now is clamped to it or rejected, as the policy says. Consents
+// without a region, or in a region without a policy, are not capped.
+func applyRegionExpiryCap(ctx contractapi.TransactionContextInterface, consent *Consent, now time.Time) error {
+	if consent.Region == "" {
+		return nil
+	}
+	policies, err := getRegionExpiryPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	policy, ok := policies[consent.Region]
+	if !ok {
+		return nil
+	}
+
+	expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+	if err != nil {
+		return err
+	}
+	limit := now.AddDate(0, 0, policy.MaxDays)
+	if !expiration.After(limit) {
+		return nil
+	}
+	if !policy.Clamp {
+		return fmt.Errorf("invalid expirationDate %q: consents in region %s may be valid for at most %d days", consent.ExpirationDate, consent.Region, policy.MaxDays)
+	}
+	consent.ExpirationDate = limit.UTC().Format(time.RFC3339)
+
+	return nil
+}
+
+// validateConsentDates returns an error unless both the timestamp and the expiration date of the
+// consent parse and the consent expires strictly after it was given. An effective-from date, when
+// set, must parse and fall before the expiration date.
+func validateConsentDates(consent *Consent) error {
+	timestamp, err := parseConsentDate("timestamp", consent.Timestamp)
+	if err != nil {
+		return err
+	}
+	expiration, err := parseConsentDate("expirationDate", consent.ExpirationDate)
+	if err != nil {
+		return err
+	}
+	if !expiration.After(timestamp) {
+		return fmt.Errorf("invalid expirationDate %q: must be after timestamp %q", consent.ExpirationDate, consent.Timestamp)
+	}
+	if consent.EffectiveFrom != "" {
+		effectiveFrom, err := parseConsentDate("effectiveFrom", consent.EffectiveFrom)
+		if err != nil {
+			return err
+		}
+		if !effectiveFrom.Before(expiration) {
+			return fmt.Errorf("invalid effectiveFrom %q: must be before expirationDate %q", consent.EffectiveFrom, consent.ExpirationDate)
+		}
+	}
+
+	return nil
+}
+
+// validateServiceForProvider returns an error unless the service is offered by the provider.
+func validateServiceForProvider(ctx contractapi.TransactionContextInterface, service string, provider string) error {
+	matrix, err := getServiceProviderMatrix(ctx)
+	if err != nil {
+		return err
+	}
+	if !contains(matrix[provider], service) {
+		return fmt.Errorf("invalid service %q: provider %s offers %v", service, provider, matrix[provider])
+	}
+
+	return nil
+}
+
+// defaultExpirationDate returns the expiration date of a consent created without one. The
+// precedence is: an explicit expiration date, then the provider's default expiry days, then the
+// global default expiry days; when neither default is set the expiration date is required.
+func defaultExpirationDate(ctx contractapi.TransactionContextInterface, consent *Consent, now time.Time) (string, error) {
+	var providerDefaults map[string]int
+	_, err := getConfig(ctx, providerExpiryDaysConfig, &providerDefaults)
+	if err != nil {
+		return "", err
+	}
+	days := providerDefaults[consent.Provider]
+	if days == 0 {
+		_, err = getConfig(ctx, defaultExpiryDaysConfig, &days)
+		if err != nil {
+			return "", err
+		}
+	}
+	if days == 0 {
+		return "", fmt.Errorf("the consent %s has no expirationDate and no default expiry is configured", consent.ID)
+	}
+
+	return now.AddDate(0, 0, days).UTC().Format(time.RFC3339), nil
+}
+
+// validateRetentionCategory returns an error unless category is an allowed retention category.
+func validateRetentionCategory(ctx contractapi.TransactionContextInterface, category string) error {
+	categories, err := getConfigList(ctx, retentionCategoriesConfig, defaultRetentionCategories)
+	if err != nil {
+		return err
+	}
+	if !contains(categories, category) {
+		return fmt.Errorf("invalid retentionCategory %q: must be one of %v", category, categories)
+	}
+
+	return nil
+}
+
+// pastExpirationAllowed reports whether the caller requested the historical import override,
+// failing if a non-admin tries to use it.
+func pastExpirationAllowed(ctx contractapi.TransactionContextInterface) (bool, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return false, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	if string(transient[allowPastExpirationTransientKey]) != "true" {
+		return false, nil
+	}
+
+	err = assertAdmin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("%s override: %v", allowPastExpirationTransientKey, err)
+	}
+
+	return true, nil
+}
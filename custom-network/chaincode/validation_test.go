@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConsentDates(t *testing.T) {
+	tests := []struct {
+		name           string
+		timestamp      string
+		expirationDate string
+		wantErr        string // a substring of the error, empty when valid
+	}{
+		{"expires after timestamp", "2023-01-01T00:00:00Z", "2024-01-01T00:00:00Z", ""},
+		{"date-only values", "2023-01-01", "2023-01-02", ""},
+		{"expires before timestamp", "2023-01-01", "2020-01-01", `invalid expirationDate "2020-01-01"`},
+		{"expires at timestamp", "2023-01-01T00:00:00Z", "2023-01-01T00:00:00Z", "invalid expirationDate"},
+		{"unparseable timestamp", "yesterday", "2024-01-01", `invalid timestamp "yesterday"`},
+		{"unparseable expiration", "2023-01-01", "never", `invalid expirationDate "never"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConsentDates(&Consent{ID: "consent1", Timestamp: tt.timestamp, ExpirationDate: tt.expirationDate})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateConsentDates returned %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateConsentDates returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}